@@ -3,13 +3,16 @@ package main
 import (
 	"context"
 	_ "embed"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
+	"maps"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
@@ -30,6 +33,21 @@ var shellHookBash string
 //go:embed shell/hook.zsh
 var shellHookZsh string
 
+//go:embed shell/hook.nu
+var shellHookNu string
+
+//go:embed shell/hook.xonsh
+var shellHookXonsh string
+
+// shellHooks are the hooks printed by shell:hook, keyed by shell
+var shellHooks = map[string]string{
+	"bash":  shellHookBash,
+	"zsh":   shellHookZsh,
+	"fish":  shellHookFish,
+	"nu":    shellHookNu,
+	"xonsh": shellHookXonsh,
+}
+
 func main() {
 	if Version == "" {
 		Version = fmt.Sprintf("nightly | %s", time.Now().Format(time.RFC3339))
@@ -45,14 +63,18 @@ func main() {
 				Name:    "init",
 				Suggest: true,
 				Action: func(ctx context.Context, _ *cli.Command) error {
-					if _, err := os.Stat("nixy.yml"); err != nil {
-						if errors.Is(err, fs.ErrNotExist) {
-							return nixy.InitNixyFile(ctx, "nixy.yml")
+					for _, fn := range nixy.NixyFileNames {
+						if _, err := os.Stat(fn); err != nil {
+							if errors.Is(err, fs.ErrNotExist) {
+								continue
+							}
+							return err
 						}
-						return err
+
+						return nil
 					}
 
-					return nil
+					return nixy.InitNixyFile(ctx, "nixy.yml")
 				},
 			},
 			{
@@ -69,7 +91,7 @@ func main() {
 								return err
 							}
 							for _, profile := range profiles {
-								fmt.Printf("🪪 %s (%s)\n", filepath.Base(profile), profile)
+								fmt.Printf("🪪 %s (%s)\n", profile.Name, profile.Path)
 							}
 							return nil
 						},
@@ -117,53 +139,585 @@ func main() {
 							return nixy.ProfileEdit(ctx, c.Args().First())
 						},
 					},
+					{
+						Name:      "show",
+						UsageText: "nixy profile show [profile-name]",
+						Action: func(ctx context.Context, c *cli.Command) error {
+							name := c.Args().First()
+							if name == "" {
+								name = nixy.CurrentProfileName()
+							}
+
+							details, err := nixy.ProfileShow(ctx, name)
+							if err != nil {
+								return err
+							}
+
+							printProfileDetails(details)
+							return nil
+						},
+					},
+					{
+						Name:      "remove",
+						Aliases:   []string{"rm"},
+						UsageText: "nixy profile remove <profile-name>",
+						Action: func(ctx context.Context, c *cli.Command) error {
+							if c.NArg() != 1 {
+								return fmt.Errorf("must specify the profile to remove, as nixy profile remove <profile-name>")
+							}
+
+							if err := nixy.ProfileRemove(ctx, c.Args().First()); err != nil {
+								return err
+							}
+
+							fmt.Printf("🗑️  removed profile %s\n", c.Args().First())
+							return nil
+						},
+					},
+					{
+						Name:      "export",
+						UsageText: "nixy profile export <profile-name> -o <file>.tar.zst [--include <fake-home path>...] [--with-store]",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "output",
+								Aliases:  []string{"o"},
+								Usage:    "archive to write, compressed as per its extension (.tar.zst, .tar.gz or .tar)",
+								Required: true,
+							},
+							&cli.StringSliceFlag{
+								Name:  "include",
+								Usage: "also exports this path (relative to fake-home), besides " + strings.Join(nixy.FakeHomeExportIncludes, " and "),
+							},
+							&cli.BoolFlag{
+								Name:  "with-store",
+								Usage: "also includes the profile's whole private nix store (not just the closure of its packages)",
+							},
+						},
+						Action: func(ctx context.Context, c *cli.Command) error {
+							name := c.Args().First()
+							if name == "" {
+								name = nixy.CurrentProfileName()
+							}
+
+							if err := nixy.ProfileExport(ctx, name, c.String("output"), c.Bool("with-store"), c.StringSlice("include")); err != nil {
+								return err
+							}
+
+							fmt.Printf("📦 exported profile %s to %s\n", name, c.String("output"))
+							return nil
+						},
+					},
+					{
+						Name:      "import",
+						UsageText: "nixy profile import <file> [--name <profile-name>]",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "name",
+								Usage: "name of the imported profile, defaults to the name it was exported with",
+							},
+						},
+						Action: func(ctx context.Context, c *cli.Command) error {
+							if c.NArg() != 1 {
+								return fmt.Errorf("must specify the archive to import, as nixy profile import <file>")
+							}
+
+							name, err := nixy.ProfileImport(ctx, c.Args().First(), c.String("name"))
+							if err != nil {
+								return err
+							}
+
+							fmt.Printf("🪪 imported profile %s, use it with NIXY_PROFILE=%s\n", name, name)
+							return nil
+						},
+					},
+					{
+						Name:      "rename",
+						Aliases:   []string{"mv"},
+						UsageText: "nixy profile rename <old-name> <new-name>",
+						Action: func(ctx context.Context, c *cli.Command) error {
+							if c.NArg() != 2 {
+								return fmt.Errorf("must specify old and new names, as nixy profile rename <old-name> <new-name>")
+							}
+
+							if err := nixy.ProfileRename(ctx, c.Args().Get(0), c.Args().Get(1)); err != nil {
+								return err
+							}
+
+							fmt.Printf("🪪 renamed profile %s to %s\n", c.Args().Get(0), c.Args().Get(1))
+							return nil
+						},
+					},
 				},
 				Action: func(context.Context, *cli.Command) error {
-					v, ok := os.LookupEnv("NIXY_PROFILE")
-					if !ok {
-						v = "default"
+					fmt.Println(nixy.CurrentProfileName())
+					return nil
+				},
+			},
+			shellHookCommand(),
+			{
+				Name:   "hook-env",
+				Usage:  "prints statements, that load (or unload) the workspace env in the current shell, used by shell hooks",
+				Hidden: true,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "shell",
+						Usage:    "shell to print statements for, one of " + strings.Join(nixy.HookShells, ", "),
+						Required: true,
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					// INFO: leaving a workspace is just not finding a nixy file anymore
+					file, err := locateNixyfile(c)
+					if err != nil {
+						file = ""
+					}
+
+					out, err := nixy.HookEnv(ctx, c.String("shell"), file)
+					if err != nil {
+						return err
 					}
-					fmt.Println(v)
+
+					fmt.Print(out)
 					return nil
 				},
 			},
 			{
-				Name:    "shell:hook",
+				Name:    "shell",
 				Suggest: true,
-				Arguments: []cli.Argument{
-					&cli.StringArg{
-						Name:   "shell",
-						Config: cli.StringConfig{TrimSpace: true},
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "variant",
+						Usage:   "shell variant to use, as defined in nixy.yml shells",
+						Sources: cli.EnvVars("NIXY_SHELL_VARIANT"),
 					},
 				},
 				Action: func(ctx context.Context, c *cli.Command) error {
-					shell := c.StringArg("shell")
-					switch shell {
-					case "fish":
-						fmt.Print(shellHookFish)
-					case "bash":
-						fmt.Print(shellHookBash)
-					case "zsh":
-						fmt.Print(shellHookZsh)
-					default:
-						return fmt.Errorf("unsupported shell: %s (supported: fish, bash, zsh)", shell)
+					n, err := loadFromNixyfile(ctx, c)
+					if err != nil {
+						return err
+					}
+
+					n.Context.ShellVariant = c.String("variant")
+
+					// INFO: args are run as a bash snippet (e.g. `nixy shell 'make && echo ok'`), and a shell name
+					// (e.g. `nixy shell nu`) is just such a snippet, launching that shell with the workspace env
+					return n.Shell(n.Context, strings.Join(c.Args().Slice(), " "))
+				},
+			},
+			{
+				Name:    "allow",
+				Usage:   "trusts nixy.yml (in its current content), to be run by shell hooks and nixy commands",
+				Suggest: true,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "check",
+						Usage: "only checks if nixy.yml is allowed, exits non-zero if not",
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					file, err := locateNixyfile(c)
+					if err != nil {
+						return err
 					}
+
+					if c.Bool("check") {
+						status, err := nixy.CheckAllowed(file)
+						if err != nil {
+							return err
+						}
+
+						if status != nixy.AllowStatusAllowed {
+							return &nixy.NotAllowedError{File: file, Status: status}
+						}
+						return nil
+					}
+
+					if err := nixy.Allow(file); err != nil {
+						return err
+					}
+
+					fmt.Printf("✅ allowed %s\n", file)
 					return nil
 				},
 			},
 			{
-				Name:    "shell",
+				Name:    "deny",
+				Usage:   "revokes trust from nixy.yml",
 				Suggest: true,
+				Action: func(ctx context.Context, c *cli.Command) error {
+					file, err := locateNixyfile(c)
+					if err != nil {
+						return err
+					}
+
+					if err := nixy.Deny(file); err != nil {
+						return err
+					}
+
+					fmt.Printf("🚫 denied %s\n", file)
+					return nil
+				},
+			},
+			{
+				Name:      "exec",
+				Usage:     "executes a command inside the workspace, preserving its arguments as is",
+				UsageText: "nixy exec -- <cmd> [args...]",
+				Suggest:   true,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "variant",
+						Usage:   "shell variant to use, as defined in nixy.yml shells",
+						Sources: cli.EnvVars("NIXY_SHELL_VARIANT"),
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					if c.NArg() == 0 {
+						return fmt.Errorf("must specify a command to execute, as nixy exec -- <cmd> [args...]")
+					}
+
+					n, err := loadFromNixyfile(ctx, c)
+					if err != nil {
+						return err
+					}
+
+					n.Context.ShellVariant = c.String("variant")
+
+					return n.Exec(n.Context, c.Args().Slice())
+				},
+			},
+			{
+				Name:      "run",
+				Usage:     "runs a script from nixy.yml scripts, inside the workspace",
+				UsageText: "nixy run <script> [-- args...]",
+				Suggest:   true,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "list",
+						Usage: "lists the scripts",
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					if c.Bool("list") || c.NArg() == 0 {
+						file, err := locateNixyfile(c)
+						if err != nil {
+							return err
+						}
+
+						scripts, err := nixy.LoadScripts(ctx, file)
+						if err != nil {
+							return err
+						}
+
+						printScripts(scripts)
+						return nil
+					}
+
+					n, err := loadFromNixyfile(ctx, c)
+					if err != nil {
+						return err
+					}
+
+					return n.Run(n.Context, c.Args().First(), c.Args().Tail())
+				},
+			},
+			{
+				Name:      "env",
+				Usage:     "prints the workspace env vars, without starting a shell",
+				UsageText: "nixy env [--format dotenv|json|shell|fish|github-actions]",
+				Suggest:   true,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "output format, one of " + strings.Join(nixy.EnvFormats, ", "),
+						Value: "dotenv",
+						Validator: func(s string) error {
+							if !slices.Contains(nixy.EnvFormats, s) {
+								return fmt.Errorf("unsupported format %q (supported: %s)", s, strings.Join(nixy.EnvFormats, ", "))
+							}
+							return nil
+						},
+					},
+					&cli.StringFlag{
+						Name:    "variant",
+						Usage:   "shell variant to use, as defined in nixy.yml shells",
+						Sources: cli.EnvVars("NIXY_SHELL_VARIANT"),
+					},
+				},
 				Action: func(ctx context.Context, c *cli.Command) error {
 					n, err := loadFromNixyfile(ctx, c)
 					if err != nil {
 						return err
 					}
 
-					if err := n.Shell(n.Context, strings.Join(c.Args().Slice(), " ")); err != nil {
+					n.Context.ShellVariant = c.String("variant")
+
+					env, err := n.WorkspaceEnv(n.Context)
+					if err != nil {
+						return err
+					}
+
+					out, err := nixy.FormatEnv(env, c.String("format"))
+					if err != nil {
+						return err
+					}
+
+					fmt.Print(out)
+					return nil
+				},
+			},
+			{
+				Name:    "workspace",
+				Usage:   "manages workspaces, i.e. generated flakes of every project nixy has been used in",
+				Suggest: true,
+				Commands: []*cli.Command{
+					{
+						Name:    "list",
+						Aliases: []string{"ls"},
+						Action: func(ctx context.Context, _ *cli.Command) error {
+							workspaces, err := nixy.ListWorkspaces()
+							if err != nil {
+								return err
+							}
+
+							printWorkspaces(workspaces)
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:    "gc",
+				Usage:   "removes workspaces, whose project no longer exists, or which have not been used for --older-than days",
+				Suggest: true,
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "older-than",
+						Usage: "also remove workspaces not used for these many days (0 disables it)",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "only prints the workspaces, that would be removed",
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					dryRun := c.Bool("dry-run")
+
+					removed, err := nixy.GCWorkspaces(time.Duration(c.Int("older-than"))*24*time.Hour, dryRun)
+					if err != nil {
+						return err
+					}
+
+					action := "removed"
+					if dryRun {
+						action = "would remove"
+					}
+
+					for _, ws := range removed {
+						fmt.Printf("🗑️  %s %s (%s)\n", action, ws.Dir, ws.Reason)
+					}
+
+					if len(removed) == 0 {
+						fmt.Println("✅ no workspaces to remove")
+					}
+					return nil
+				},
+			},
+			{
+				Name:    "doctor",
+				Usage:   "checks everything the executors depend on, and tells how to fix problems",
+				Suggest: true,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "prints checks as json",
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					checks := nixy.Doctor(ctx)
+
+					if c.Bool("json") {
+						b, err := json.MarshalIndent(checks, "", "  ")
+						if err != nil {
+							return err
+						}
+						fmt.Println(string(b))
+					} else {
+						printDoctorChecks(checks)
+					}
+
+					failed := 0
+					for _, check := range checks {
+						if check.Status == nixy.DoctorStatusFail {
+							failed++
+						}
+					}
+
+					if failed > 0 {
+						return &nixy.ExitError{Code: nixy.ExitCodeGeneric, Err: fmt.Errorf("%d doctor check(s) failed", failed)}
+					}
+					return nil
+				},
+			},
+			{
+				Name:    "validate",
+				Usage:   "validates nixy.yml, and reports every problem with its line and column",
+				Suggest: true,
+				Action: func(ctx context.Context, c *cli.Command) error {
+					file, err := locateNixyfile(c)
+					if err != nil {
+						return err
+					}
+
+					diagnostics, err := nixy.Validate(file)
+					if err != nil {
 						return err
 					}
 
+					for _, d := range diagnostics {
+						fmt.Println(d)
+					}
+
+					if len(diagnostics) > 0 {
+						return &nixy.ExitError{Code: nixy.ExitCodeConfig, Err: fmt.Errorf("found %d problem(s) in %s", len(diagnostics), file)}
+					}
+
+					fmt.Printf("✅ %s is valid\n", file)
+					return nil
+				},
+			},
+			{
+				Name:      "add",
+				Usage:     "adds packages to nixy.yml",
+				UsageText: "nixy add go_1_22 unstable#ripgrep",
+				Suggest:   true,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "library",
+						Usage: "adds them as libraries, instead of packages",
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					if c.NArg() == 0 {
+						return fmt.Errorf("must specify at least one package")
+					}
+
+					file, err := locateNixyfile(c)
+					if err != nil {
+						return err
+					}
+
+					return nixy.AddPackages(file, c.Args().Slice(), c.Bool("library"))
+				},
+			},
+			{
+				Name:      "remove",
+				Aliases:   []string{"rm"},
+				Usage:     "removes packages from nixy.yml",
+				UsageText: "nixy remove nodejs",
+				Suggest:   true,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "library",
+						Usage: "removes them from libraries, instead of packages",
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					if c.NArg() == 0 {
+						return fmt.Errorf("must specify at least one package")
+					}
+
+					file, err := locateNixyfile(c)
+					if err != nil {
+						return err
+					}
+
+					return nixy.RemovePackages(file, c.Args().Slice(), c.Bool("library"))
+				},
+			},
+			{
+				Name:    "lock",
+				Usage:   "(re)generates nixy.lock, pinning every workspace input",
+				Suggest: true,
+				Action: func(ctx context.Context, c *cli.Command) error {
+					file, err := locateNixyfile(c)
+					if err != nil {
+						return err
+					}
+
+					lock, err := nixy.Lock(ctx, file)
+					if err != nil {
+						return err
+					}
+
+					fmt.Printf("🔒 locked %d nixpkgs, %d flake inputs and %d url packages in %s\n",
+						len(lock.NixPkgs), len(lock.FlakeInputs), len(lock.URLPackages), nixy.LockFilePath(file))
+					return nil
+				},
+			},
+			{
+				Name:      "update",
+				Usage:     "moves nixpkgs pins to the latest commit of a channel",
+				UsageText: "nixy update [nixpkgs-key...] (updates only the default key, unless keys or --all are given)",
+				Suggest:   true,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "channel",
+						Usage: "nixpkgs channel (or branch) to update to, e.g. nixos-24.11",
+						Value: nixy.DefaultNixpkgsChannel,
+					},
+					&cli.BoolFlag{
+						Name:  "all",
+						Usage: "updates every nixpkgs key, instead of only the default one",
+					},
+					&cli.StringFlag{
+						Name:    "github-api",
+						Usage:   "GitHub API base URL",
+						Value:   nixy.DefaultGitHubAPI,
+						Sources: cli.EnvVars("NIXY_GITHUB_API"),
+					},
+				},
+				Action: func(ctx context.Context, c *cli.Command) error {
+					file, err := locateNixyfile(c)
+					if err != nil {
+						return err
+					}
+
+					updates, err := nixy.UpdateNixpkgs(ctx, file, nixy.UpdateOptions{
+						Keys:      c.Args().Slice(),
+						All:       c.Bool("all"),
+						Channel:   c.String("channel"),
+						GitHubAPI: c.String("github-api"),
+					})
+					if err != nil {
+						return err
+					}
+
+					if len(updates) == 0 {
+						fmt.Printf("✅ nixpkgs are already at the latest %s\n", c.String("channel"))
+						return nil
+					}
+
+					for _, u := range updates {
+						fmt.Printf("⬆️  nixpkgs.%s: %s -> %s\n", u.Key, u.OldCommit, u.NewCommit)
+					}
+
+					if _, err := os.Stat(nixy.LockFilePath(file)); err == nil {
+						fmt.Printf("%s is now out of date, run `nixy lock` to update it\n", nixy.LockFilePath(file))
+					}
+					return nil
+				},
+			},
+			{
+				Name:    "schema",
+				Usage:   "prints JSON Schema for nixy.yml, to be used with editors (e.g. yaml-language-server)",
+				Suggest: true,
+				Action: func(context.Context, *cli.Command) error {
+					b, err := nixy.JSONSchema()
+					if err != nil {
+						return err
+					}
+
+					fmt.Print(string(b))
 					return nil
 				},
 			},
@@ -187,45 +741,61 @@ func main() {
 	} else {
 		commands = []*cli.Command{
 			{
-				Name:    "build",
-				Suggest: true,
+				Name:      "run",
+				Usage:     "runs a script from nixy.yml scripts",
+				UsageText: "nixy run <script> [-- args...]",
+				Suggest:   true,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "list",
+						Usage: "lists the scripts",
+					},
+				},
 				Action: func(ctx context.Context, c *cli.Command) error {
 					n, err := nixy.LoadInNixyShell(ctx)
 					if err != nil {
 						return err
 					}
 
-					if err := n.Build(ctx, c.Args().First()); err != nil {
+					if c.Bool("list") || c.NArg() == 0 {
+						printScripts(n.Scripts)
+						return nil
+					}
+
+					return n.Run(ctx, c.Args().First(), c.Args().Tail())
+				},
+			},
+			{
+				Name:      "exec",
+				Usage:     "executes a command, preserving its arguments as is",
+				UsageText: "nixy exec -- <cmd> [args...]",
+				Suggest:   true,
+				Action: func(ctx context.Context, c *cli.Command) error {
+					n, err := nixy.LoadInNixyShell(ctx)
+					if err != nil {
 						return err
 					}
 
-					return nil
+					return n.Exec(ctx, c.Args().Slice())
 				},
 			},
 			{
-				Name:    "shell:hook",
+				Name:    "build",
 				Suggest: true,
-				Arguments: []cli.Argument{
-					&cli.StringArg{
-						Name:   "shell",
-						Config: cli.StringConfig{TrimSpace: true},
-					},
-				},
 				Action: func(ctx context.Context, c *cli.Command) error {
-					shell := c.StringArg("shell")
-					switch shell {
-					case "fish":
-						fmt.Print(shellHookFish)
-					case "bash":
-						fmt.Print(shellHookBash)
-					case "zsh":
-						fmt.Print(shellHookZsh)
-					default:
-						return fmt.Errorf("unsupported shell: %s (supported: fish, bash, zsh)", shell)
+					n, err := nixy.LoadInNixyShell(ctx)
+					if err != nil {
+						return err
 					}
+
+					if err := n.Build(ctx, c.Args().First()); err != nil {
+						return err
+					}
+
 					return nil
 				},
 			},
+			shellHookCommand(),
 		}
 	}
 
@@ -240,6 +810,24 @@ func main() {
 				Required: false,
 				Value:    false,
 			},
+			&cli.StringFlag{
+				Name:      "file",
+				Aliases:   []string{"f"},
+				Usage:     "path to nixy file, instead of the nearest nixy.yml, nixy.yaml or .nixy.yml",
+				Sources:   cli.EnvVars("NIXY_FILE"),
+				TakesFile: true,
+			},
+			&cli.BoolFlag{
+				Name:    "yes",
+				Aliases: []string{"y"},
+				Usage:   "answers yes to every confirmation (e.g. downloading static nix binary), for CI and Dockerfiles",
+				Sources: cli.EnvVars("NIXY_ASSUME_YES"),
+			},
+			&cli.BoolFlag{
+				Name:    "no-input",
+				Usage:   "never prompts, confirmations fail unless --yes is passed",
+				Sources: cli.EnvVars("NIXY_NO_INPUT"),
+			},
 		},
 
 		// ShellCompletionCommandName: "completion:shell",
@@ -248,12 +836,15 @@ func main() {
 		Before: func(ctx context.Context, c *cli.Command) (context.Context, error) {
 			logger := fastlog.New(fastlog.Console(), fastlog.ShowDebugLogs(c.Bool("debug")))
 			slog.SetDefault(logger.Slog())
-			return ctx, nil
+			return nixy.WithPromptOptions(ctx, nixy.PromptOptions{AssumeYes: c.Bool("yes"), NoInput: c.Bool("no-input")}), nil
 		},
 
 		Commands: commands,
 
 		Suggest: true,
+
+		// INFO: exit codes are handled in main, so that the exit code of processes run by nixy is passed through
+		ExitErrHandler: func(context.Context, *cli.Command, error) {},
 	}
 
 	ctx, cf := signal.NotifyContext(context.TODO(), syscall.SIGINT, syscall.SIGTERM)
@@ -265,39 +856,155 @@ func main() {
 	}()
 
 	if err := cmd.Run(ctx, os.Args); err != nil {
-		slog.Error(err.Error())
+		// INFO: a process run by nixy, has already reported its own failure
+		if !nixy.IsProcessExit(err) {
+			slog.Error(err.Error())
+		}
+		os.Exit(nixy.ExitCode(err))
 	}
 }
 
+func shellHookCommand() *cli.Command {
+	return &cli.Command{
+		Name:    "shell:hook",
+		Usage:   "prints the shell hook, which activates nixy on entering a directory with nixy.yml",
+		Suggest: true,
+		Arguments: []cli.Argument{
+			&cli.StringArg{
+				Name:   "shell",
+				Config: cli.StringConfig{TrimSpace: true},
+			},
+		},
+		Action: func(ctx context.Context, c *cli.Command) error {
+			shell := c.StringArg("shell")
+			hook, ok := shellHooks[shell]
+			if !ok {
+				return fmt.Errorf("unsupported shell: %s (supported: %s)", shell, strings.Join(slices.Sorted(maps.Keys(shellHooks)), ", "))
+			}
+			fmt.Print(hook)
+			return nil
+		},
+	}
+}
+
+func printScripts(scripts map[string]nixy.Script) {
+	if len(scripts) == 0 {
+		fmt.Println("no scripts defined in nixy.yml")
+		return
+	}
+
+	names := slices.Sorted(maps.Keys(scripts))
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+
+	for _, name := range names {
+		script := scripts[name]
+		description := script.Description
+		if description == "" {
+			description, _, _ = strings.Cut(strings.TrimSpace(script.Cmd), "\n")
+		}
+
+		if len(script.Depends) > 0 {
+			description += fmt.Sprintf(" (depends on: %s)", strings.Join(script.Depends, ", "))
+		}
+
+		fmt.Printf("📜 %-*s  %s\n", width, name, description)
+	}
+}
+
+// loadFromNixyfile loads the nixy file, only if it is allowed, as every command
+// running in the workspace sources its shellHook (i.e. runs onShellEnter)
 func loadFromNixyfile(ctx context.Context, c *cli.Command) (*nixy.NixyWrapper, error) {
+	file, err := locateNixyfile(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := nixy.EnsureAllowed(ctx, file); err != nil {
+		return nil, err
+	}
+
+	return nixy.LoadFromFile(ctx, file)
+}
+
+// locateNixyfile returns path to the nixy file, either as specified with --file (or NIXY_FILE),
+// or the nearest one found walking up from the current directory
+func locateNixyfile(c *cli.Command) (string, error) {
 	if c.IsSet("file") {
-		return nixy.LoadFromFile(ctx, c.String("file"))
+		file, err := filepath.Abs(c.String("file"))
+		if err != nil {
+			return "", err
+		}
+
+		if _, err := os.Stat(file); err != nil {
+			return "", fmt.Errorf("nixy file (%s) does not exist: %w", file, err)
+		}
+
+		return file, nil
 	}
 
 	dir, err := os.Getwd()
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	oldDir := ""
+	return nixy.FindNixyFile(dir)
+}
 
-	nixyConfigFiles := []string{"nixy.yml"}
+func printDoctorChecks(checks []nixy.DoctorCheck) {
+	icons := map[nixy.DoctorStatus]string{
+		nixy.DoctorStatusOK:   "✅",
+		nixy.DoctorStatusWarn: "⚠️ ",
+		nixy.DoctorStatusFail: "❌",
+	}
 
-	for oldDir != dir {
-		for _, fn := range nixyConfigFiles {
-			if _, err := os.Stat(filepath.Join(dir, fn)); err != nil {
-				if !os.IsNotExist(err) {
-					return nil, err
-				}
-				continue
-			}
+	for _, check := range checks {
+		fmt.Printf("%s %s: %s\n", icons[check.Status], check.Name, check.Message)
+		if check.Fix != "" {
+			fmt.Printf("   ↳ %s\n", check.Fix)
+		}
+	}
+}
 
-			return nixy.LoadFromFile(ctx, filepath.Join(dir, fn))
+func printWorkspaces(workspaces []nixy.Workspace) {
+	if len(workspaces) == 0 {
+		fmt.Println("no workspaces found")
+		return
+	}
+
+	for _, ws := range workspaces {
+		project := ws.ProjectDir
+		switch {
+		case !ws.HasMetadata:
+			project = fmt.Sprintf("%s (unknown project)", filepath.Base(ws.Dir))
+		case !ws.ProjectExists():
+			project += " (missing)"
 		}
 
-		oldDir = dir
-		dir = filepath.Dir(dir)
+		details := []string{"profile: " + ws.Profile, "last used: " + ws.LastUsedAt.Format(time.DateTime)}
+		if ws.Executor != "" {
+			details = append(details, "executor: "+ws.Executor.String())
+		}
+		if ws.NixyVersion != "" {
+			details = append(details, "nixy: "+ws.NixyVersion)
+		}
+
+		fmt.Printf("📁 %s\n   %s\n", project, strings.Join(details, ", "))
+	}
+}
+
+func printProfileDetails(details *nixy.ProfileDetails) {
+	nixpkgs := details.NixPkgsCommitHash
+	if nixpkgs == "" {
+		nixpkgs = "(not pinned)"
 	}
 
-	return nil, fmt.Errorf("failed to locate your nearest Nixyfile")
+	fmt.Printf("🪪 %s\n", details.Name)
+	fmt.Printf("   path:       %s\n", details.Path)
+	fmt.Printf("   nixpkgs:    %s\n", nixpkgs)
+	fmt.Printf("   workspaces: %d\n", details.WorkspaceCount)
+	fmt.Printf("   disk usage: %s (nix store: %s)\n", nixy.HumanizeBytes(details.DiskUsage), nixy.HumanizeBytes(details.NixStoreDiskUsage))
+	fmt.Printf("   packages:   %s\n", strings.Join(details.Packages, ", "))
 }
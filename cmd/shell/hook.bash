@@ -4,8 +4,28 @@ __nixy_debug() {
   echo "[## NIXY DEBUG] $@"
 }
 
+# nixy.yml, nixy.yaml or .nixy.yml, same as nixy.NixyFileNames
+__nixy_has_config() {
+  [[ -f nixy.yml ]] || [[ -f nixy.yaml ]] || [[ -f .nixy.yml ]]
+}
+
+# env mode loads the workspace env in this shell (default with local executor), shell mode launches a nested nixy shell
+# set NIXY_HOOK_MODE=shell to always launch a nested nixy shell
+__nixy_hook_env_mode() {
+  case "${NIXY_HOOK_MODE:-}" in
+    env) return 0 ;;
+    shell) return 1 ;;
+  esac
+  [[ "${NIXY_EXECUTOR:-local}" == "local" ]]
+}
+
 __nixy_shell_hook() {
-  if [[ -z "$NIXY_SHELL" ]] && [[ ! -f nixy.yml ]]; then
+  if [[ -z "$NIXY_SHELL" ]] && __nixy_hook_env_mode; then
+    eval "$(nixy hook-env --shell bash)"
+    return
+  fi
+
+  if [[ -z "$NIXY_SHELL" ]] && ! __nixy_has_config; then
     # __ps1_cleanup
     return
   fi
@@ -21,6 +41,12 @@ __nixy_shell_hook() {
 
   if [[ -z "$NIXY_SHELL" ]] && [[ "$NIXY_LAST_DIR" != "$PWD" ]]; then
     NIXY_LAST_DIR="$PWD"
+
+    # nixy shell runs hooks (e.g. onShellEnter) from nixy.yml, so it must be allowed first (with nixy allow)
+    if ! nixy allow --check; then
+      return
+    fi
+
     nixy shell
   fi
 }
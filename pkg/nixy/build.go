@@ -43,11 +43,7 @@ func (nixy *NixyWrapper) Build(ctx *Context, target string) error {
 		slog.Debug("Shell Exited")
 	}()
 
-	if err := cmd.Run(); err != nil {
-		return err
-	}
-
-	return nil
+	return runProcess(cmd)
 }
 
 func (n *InShellNixy) Build(ctx context.Context, target string) error {
@@ -89,9 +85,5 @@ func (n *InShellNixy) Build(ctx context.Context, target string) error {
 		slog.Debug("Build Finished")
 	}()
 
-	if err := cmd.Run(); err != nil {
-		return err
-	}
-
-	return nil
+	return runProcess(cmd)
 }
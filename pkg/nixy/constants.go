@@ -8,6 +8,9 @@ import (
 	"runtime"
 )
 
+// flakeUtilsRev is the flake-utils revision, that workspace flakes use unless pinned by nixy.lock
+const flakeUtilsRev = "11707dc2f618dd54ca8739b309ec4fc024de578b"
+
 var profileBasePath = filepath.Join(XDGDataDir(), "profiles")
 
 func profilePath(profile string) string {
@@ -20,6 +23,11 @@ func flakeDirPath(profile string) string {
 		panic(err)
 	}
 
+	return workspaceFlakeDirPath(profile, pwd)
+}
+
+// workspaceFlakeDirPath is the workspace flake dir of pwd, in the profile
+func workspaceFlakeDirPath(profile string, pwd string) string {
 	h := md5.New()
 	h.Write([]byte(pwd))
 
@@ -2,9 +2,12 @@ package nixy
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"golang.org/x/term"
 )
 
 type Context struct {
@@ -16,8 +19,20 @@ type Context struct {
 	NixyBinPath    string
 	InNixyShell    bool
 
+	// ShellVariant is the shell variant (from nixy.yml shells) to use, empty means the default shell
+	ShellVariant string
+
+	// AssumeYes answers yes to every confirmation (--yes, or NIXY_ASSUME_YES)
+	AssumeYes bool
+
+	// NoInput never prompts the user (--no-input, or NIXY_NO_INPUT), confirmations fail unless AssumeYes is set
+	NoInput bool
+
 	PWD string
 
+	// NixyFile is the nixy file in use (nearest one, or as set with --file), exported as NIXY_FILE in nixy shell
+	NixyFile string
+
 	// Nixy Constants
 	NixyDataDir string
 }
@@ -26,21 +41,48 @@ func (ctx *Context) IsLocalMode() bool {
 	return ctx.NixyMode == LocalMode
 }
 
+// PromptOptions tell how to handle prompts, when nixy is run non-interactively (e.g. in CI)
+type PromptOptions struct {
+	AssumeYes bool
+	NoInput   bool
+}
+
+type promptOptionsKey struct{}
+
+// WithPromptOptions returns a context, which every nixy Context created from it, uses for its prompts
+func WithPromptOptions(parent context.Context, opts PromptOptions) context.Context {
+	return context.WithValue(parent, promptOptionsKey{}, opts)
+}
+
+type readOnlyNixyFileKey struct{}
+
+// withReadOnlyNixyFile returns a context, with which loading a nixy file never fetches SHA256 of its URL packages,
+// nor writes them back to it (e.g. in hook-env, which runs on every prompt)
+func withReadOnlyNixyFile(parent context.Context) context.Context {
+	return context.WithValue(parent, readOnlyNixyFileKey{}, true)
+}
+
+func isReadOnlyNixyFile(ctx context.Context) bool {
+	readOnly, _ := ctx.Value(readOnlyNixyFileKey{}).(bool)
+	return readOnly
+}
+
 func NewContext(parent context.Context, workspaceDir string) (*Context, error) {
 	ctx := Context{
 		Context: parent,
 		PWD:     workspaceDir,
 	}
 
+	if opts, ok := parent.Value(promptOptionsKey{}).(PromptOptions); ok {
+		ctx.AssumeYes = opts.AssumeYes
+		ctx.NoInput = opts.NoInput
+	}
+
 	if v, ok := os.LookupEnv("NIXY_SHELL"); ok {
 		ctx.InNixyShell = strings.EqualFold(v, "true")
 	}
 
-	if v, ok := os.LookupEnv("NIXY_PROFILE"); ok {
-		ctx.NixyProfile = v
-	} else {
-		ctx.NixyProfile = "default"
-	}
+	ctx.NixyProfile = CurrentProfileName()
 
 	if v, ok := os.LookupEnv("NIXY_EXECUTOR"); ok {
 		ctx.NixyMode = Mode(v)
@@ -62,6 +104,33 @@ func NewContext(parent context.Context, workspaceDir string) (*Context, error) {
 	return &ctx, nil
 }
 
+// IsInteractive tells if the user could be prompted, i.e. stdin is a terminal, and --no-input is not set
+func (ctx *Context) IsInteractive() bool {
+	return !ctx.NoInput && term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// Confirm asks the user a yes/no question. With --yes, it is confirmed right away.
+// When the user could not be asked (--no-input, or stdin is not a terminal), it fails naming the flag to pass
+func (ctx *Context) Confirm(message string) (bool, error) {
+	if ctx.AssumeYes {
+		return true, nil
+	}
+
+	if !ctx.IsInteractive() {
+		return false, fmt.Errorf("%q needs confirmation, but nixy is running non-interactively. Pass --yes (or set NIXY_ASSUME_YES=true) to confirm", strings.TrimSpace(message))
+	}
+
+	return askUser(message), nil
+}
+
+// CurrentProfileName returns the profile in use, as set with NIXY_PROFILE
+func CurrentProfileName() string {
+	if v, ok := os.LookupEnv("NIXY_PROFILE"); ok {
+		return v
+	}
+	return "default"
+}
+
 func getCallerBinPath() (string, error) {
 	exe, err := os.Executable()
 	if err != nil {
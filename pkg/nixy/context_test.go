@@ -0,0 +1,51 @@
+package nixy
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestContextConfirm(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    PromptOptions
+		want    bool
+		wantErr string
+	}{
+		{
+			name: "--yes confirms without prompting",
+			opts: PromptOptions{AssumeYes: true, NoInput: true},
+			want: true,
+		},
+		{
+			name:    "--no-input fails, naming the flag to pass",
+			opts:    PromptOptions{NoInput: true},
+			wantErr: "--yes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, err := NewContext(WithPromptOptions(context.TODO(), tt.opts), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ctx.Confirm("Downloading Static Nix Binary ?")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Confirm() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Confirm() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Confirm() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
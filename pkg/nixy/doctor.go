@@ -0,0 +1,291 @@
+package nixy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+type DoctorStatus string
+
+const (
+	DoctorStatusOK   DoctorStatus = "ok"
+	DoctorStatusWarn DoctorStatus = "warn"
+	DoctorStatusFail DoctorStatus = "fail"
+)
+
+// DoctorCheck is the result of checking one of the things, executors depend on
+type DoctorCheck struct {
+	Name    string       `json:"name"`
+	Status  DoctorStatus `json:"status"`
+	Message string       `json:"message"`
+
+	// Fix tells what to do about a failed check
+	Fix string `json:"fix,omitempty"`
+
+	// Executors are the executors, depending on this check (empty means all of them)
+	Executors []Mode `json:"executors,omitempty"`
+}
+
+// Doctor checks everything, the executors depend on.
+// Failures, that do not affect the executor in use (NIXY_EXECUTOR), are reported as warnings
+func Doctor(ctx context.Context) []DoctorCheck {
+	mode := LocalMode
+	if v, ok := os.LookupEnv("NIXY_EXECUTOR"); ok {
+		mode = Mode(v)
+	}
+
+	runtimePaths, rpErr := NewRuntimePaths(CurrentProfileName())
+
+	checks := []DoctorCheck{
+		checkExecutor(mode),
+		checkNix(),
+		checkBubblewrap(),
+		checkUserNamespaces("/proc/sys/kernel/unprivileged_userns_clone"),
+		checkDocker(ctx),
+		checkPodman(ctx),
+	}
+
+	if rpErr != nil {
+		checks = append(checks, DoctorCheck{
+			Name:    "runtime paths",
+			Status:  DoctorStatusFail,
+			Message: rpErr.Error(),
+			Fix:     fmt.Sprintf("ensure %s is writable, or set XDG_DATA_HOME to a writable directory", XDGDataDir()),
+		})
+	} else {
+		checks = append(checks, checkStaticNixBinary(runtimePaths.StaticNixBinPath))
+		checks = append(checks, checkRuntimePaths(runtimePaths))
+	}
+
+	checks = append(checks, checkEditor())
+
+	for i := range checks {
+		if checks[i].Status == DoctorStatusFail && len(checks[i].Executors) > 0 && !slices.Contains(checks[i].Executors, mode) {
+			checks[i].Status = DoctorStatusWarn
+		}
+	}
+
+	return checks
+}
+
+func checkExecutor(mode Mode) DoctorCheck {
+	check := DoctorCheck{Name: "executor"}
+
+	e, err := lookupExecutor(mode)
+	if err != nil {
+		check.Status = DoctorStatusFail
+		check.Message = err.Error()
+		check.Fix = fmt.Sprintf("set NIXY_EXECUTOR to a supported executor, or install %s%s on PATH", externalExecutorPrefix, mode)
+		return check
+	}
+
+	check.Status = DoctorStatusOK
+	check.Message = fmt.Sprintf("%s (built-in)", mode)
+	if ext, ok := e.(*externalExecutor); ok {
+		check.Message = fmt.Sprintf("%s (external, at %s)", mode, ext.binPath)
+	}
+	return check
+}
+
+func checkNix() DoctorCheck {
+	check := DoctorCheck{Name: "nix", Executors: []Mode{LocalMode, LocalIgnoreEnvMode}}
+
+	nixPath, err := exec.LookPath("nix")
+	if err != nil {
+		check.Status = DoctorStatusFail
+		check.Message = "nix is not found on PATH"
+		check.Fix = "install nix (https://nixos.org/download/), or use NIXY_EXECUTOR=docker, NIXY_EXECUTOR=podman or NIXY_EXECUTOR=bubblewrap"
+		return check
+	}
+
+	install := "single-user install"
+	if os.Getenv("NIX_REMOTE") == "daemon" || exists("/nix/var/nix/daemon-socket/socket") {
+		install = "daemon (multi-user) install"
+	}
+
+	check.Status = DoctorStatusOK
+	check.Message = fmt.Sprintf("found at %s, %s", nixPath, install)
+	return check
+}
+
+func checkBubblewrap() DoctorCheck {
+	check := DoctorCheck{Name: "bubblewrap", Executors: []Mode{BubbleWrapMode}}
+
+	bwrapPath, err := exec.LookPath("bwrap")
+	if err != nil {
+		check.Status = DoctorStatusFail
+		check.Message = "bwrap is not found on PATH"
+		check.Fix = "install bubblewrap with your distro's package manager"
+		return check
+	}
+
+	check.Status = DoctorStatusOK
+	check.Message = fmt.Sprintf("found at %s", bwrapPath)
+	return check
+}
+
+// checkUserNamespaces checks if unprivileged user namespaces (needed by bubblewrap) are enabled, as per sysctlFile
+func checkUserNamespaces(sysctlFile string) DoctorCheck {
+	check := DoctorCheck{Name: "user namespaces", Executors: []Mode{BubbleWrapMode}}
+
+	b, err := os.ReadFile(sysctlFile)
+	if err != nil {
+		// INFO: only some kernels (e.g. debian's) have this sysctl, others allow unprivileged user namespaces by default
+		check.Status = DoctorStatusOK
+		check.Message = "kernel.unprivileged_userns_clone is not present, unprivileged user namespaces are allowed by default"
+		return check
+	}
+
+	if strings.TrimSpace(string(b)) != "1" {
+		check.Status = DoctorStatusFail
+		check.Message = "kernel.unprivileged_userns_clone is disabled"
+		check.Fix = "run `sudo sysctl -w kernel.unprivileged_userns_clone=1`"
+		return check
+	}
+
+	check.Status = DoctorStatusOK
+	check.Message = "kernel.unprivileged_userns_clone is enabled"
+	return check
+}
+
+func checkDocker(ctx context.Context) DoctorCheck {
+	check := DoctorCheck{Name: "docker", Executors: []Mode{DockerMode}}
+
+	dockerPath, err := exec.LookPath("docker")
+	if err != nil {
+		check.Status = DoctorStatusFail
+		check.Message = "docker is not found on PATH"
+		check.Fix = "install docker (https://docs.docker.com/engine/install/)"
+		return check
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(tctx, dockerPath, "info", "--format", "{{.ServerVersion}}").CombinedOutput()
+	if err != nil {
+		check.Status = DoctorStatusFail
+		check.Message = fmt.Sprintf("docker daemon is not reachable: %s", strings.TrimSpace(string(out)))
+		check.Fix = "start the docker daemon, and ensure your user can access it (e.g. is in the docker group)"
+		return check
+	}
+
+	check.Status = DoctorStatusOK
+	check.Message = fmt.Sprintf("daemon reachable, server version %s", strings.TrimSpace(string(out)))
+	return check
+}
+
+func checkPodman(ctx context.Context) DoctorCheck {
+	check := DoctorCheck{Name: "podman", Executors: []Mode{PodmanMode}}
+
+	podmanPath, err := exec.LookPath("podman")
+	if err != nil {
+		check.Status = DoctorStatusFail
+		check.Message = "podman is not found on PATH"
+		check.Fix = "install podman (https://podman.io/docs/installation)"
+		return check
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(tctx, podmanPath, "info", "--format", "{{.Version.Version}} {{.Host.Security.Rootless}}").CombinedOutput()
+	if err != nil {
+		check.Status = DoctorStatusFail
+		check.Message = fmt.Sprintf("podman is not usable: %s", strings.TrimSpace(string(out)))
+		check.Fix = "run `podman info` to see what is wrong (e.g. missing subuid/subgid entries for your user)"
+		return check
+	}
+
+	version, rootless, _ := strings.Cut(strings.TrimSpace(string(out)), " ")
+	switch {
+	case rootless == "true":
+		check.Status = DoctorStatusOK
+		check.Message = fmt.Sprintf("podman %s, rootless", version)
+	case os.Geteuid() == 0:
+		check.Status = DoctorStatusOK
+		check.Message = fmt.Sprintf("podman %s, rootful (as root)", version)
+	default:
+		// INFO: nixy runs podman with --userns=keep-id as a regular user, which fails with rootful podman (e.g. a remote rootful service)
+		check.Status = DoctorStatusFail
+		check.Message = fmt.Sprintf("podman %s is rootful, --userns=keep-id fails with it", version)
+		check.Fix = "use rootless podman (e.g. unset CONTAINER_HOST, and run `podman system migrate`)"
+	}
+	return check
+}
+
+func checkStaticNixBinary(binPath string) DoctorCheck {
+	check := DoctorCheck{Name: "static nix binary", Executors: []Mode{DockerMode, PodmanMode, BubbleWrapMode}}
+
+	info, err := os.Stat(binPath)
+	if err != nil {
+		check.Status = DoctorStatusWarn
+		check.Message = fmt.Sprintf("%s does not exist, it will be downloaded on first use", binPath)
+		return check
+	}
+
+	if info.IsDir() || info.Mode().Perm()&0o111 == 0 {
+		check.Status = DoctorStatusFail
+		check.Message = fmt.Sprintf("%s is not executable", binPath)
+		check.Fix = fmt.Sprintf("run `chmod +x %s`, or remove it to download it again", binPath)
+		return check
+	}
+
+	check.Status = DoctorStatusOK
+	check.Message = fmt.Sprintf("found at %s", binPath)
+	return check
+}
+
+func checkRuntimePaths(rp *RuntimePaths) DoctorCheck {
+	check := DoctorCheck{Name: "runtime paths"}
+
+	for _, dir := range []string{rp.BasePath, rp.WorkspacesDir, rp.FakeHomeDir, rp.NixDir} {
+		if err := checkWritable(dir); err != nil {
+			check.Status = DoctorStatusFail
+			check.Message = fmt.Sprintf("%s is not writable: %v", dir, err)
+			check.Fix = fmt.Sprintf("fix permissions of %s (e.g. `sudo chown -R $USER %s`)", dir, rp.BasePath)
+			return check
+		}
+	}
+
+	check.Status = DoctorStatusOK
+	check.Message = fmt.Sprintf("%s is writable", rp.BasePath)
+	return check
+}
+
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".nixy-doctor-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func checkEditor() DoctorCheck {
+	check := DoctorCheck{Name: "editor"}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		check.Status = DoctorStatusWarn
+		check.Message = "$EDITOR is not set, `nixy profile edit` needs it"
+		check.Fix = "export EDITOR=<your editor> in your shell config"
+		return check
+	}
+
+	if _, err := exec.LookPath(editor); err != nil {
+		check.Status = DoctorStatusWarn
+		check.Message = fmt.Sprintf("$EDITOR (%s) is not found on PATH", editor)
+		check.Fix = "set EDITOR to an editor, available on PATH"
+		return check
+	}
+
+	check.Status = DoctorStatusOK
+	check.Message = fmt.Sprintf("$EDITOR is %s", editor)
+	return check
+}
@@ -0,0 +1,71 @@
+package nixy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckUserNamespaces(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		want    DoctorStatus
+	}{
+		{name: "sysctl not present", want: DoctorStatusOK},
+		{name: "enabled", content: "1\n", want: DoctorStatusOK},
+		{name: "disabled", content: "0\n", want: DoctorStatusFail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(dir, tt.name)
+			if tt.content != "" {
+				if err := os.WriteFile(file, []byte(tt.content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := checkUserNamespaces(file); got.Status != tt.want {
+				t.Errorf("checkUserNamespaces() = %+v, want status %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckStaticNixBinary(t *testing.T) {
+	dir := t.TempDir()
+
+	executable := filepath.Join(dir, "nix")
+	if err := os.WriteFile(executable, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	notExecutable := filepath.Join(dir, "nix-broken")
+	if err := os.WriteFile(notExecutable, []byte("#!/bin/sh\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want DoctorStatus
+	}{
+		{path: executable, want: DoctorStatusOK},
+		{path: notExecutable, want: DoctorStatusFail},
+		{path: filepath.Join(dir, "missing"), want: DoctorStatusWarn},
+	}
+
+	for _, tt := range tests {
+		t.Run(filepath.Base(tt.path), func(t *testing.T) {
+			got := checkStaticNixBinary(tt.path)
+			if got.Status != tt.want {
+				t.Errorf("checkStaticNixBinary() = %+v, want status %s", got, tt.want)
+			}
+			if got.Status == DoctorStatusFail && got.Fix == "" {
+				t.Errorf("failed check must tell how to fix it")
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package nixy
+
+import (
+	"fmt"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// editableNixyFile is a nixy file, that is being edited in place through its yaml.Node tree
+type editableNixyFile struct {
+	file    string
+	cfg     Nixy
+	docNode *yaml.Node
+}
+
+func openEditableNixyFile(file string) (*editableNixyFile, error) {
+	_, rootNode, err := readNixyNode(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if rootNode.Kind != yaml.DocumentNode || len(rootNode.Content) == 0 || rootNode.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("nixy file (%s) must be a yaml mapping", file)
+	}
+
+	ef := editableNixyFile{file: file, docNode: rootNode.Content[0]}
+	if err := rootNode.Decode(&ef.cfg); err != nil {
+		return nil, err
+	}
+	ef.cfg.rawNode = rootNode
+
+	return &ef, nil
+}
+
+// sequence returns the sequence node for the given top level key,
+// creating it after the afterKey if needed
+func (ef *editableNixyFile) sequence(key, afterKey string) *yaml.Node {
+	node := findMappingValue(ef.docNode, key)
+	if node == nil {
+		node = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		insertMappingField(ef.docNode, key, node, afterKey)
+		return node
+	}
+
+	if node.Kind != yaml.SequenceNode {
+		// INFO: an empty key (e.g. `packages:`), is parsed as a null scalar
+		node.Kind = yaml.SequenceNode
+		node.Tag = "!!seq"
+		node.Value = ""
+	}
+
+	return node
+}
+
+func (ef *editableNixyFile) sync() error {
+	return ef.cfg.SyncToDisk(ef.file)
+}
+
+// seenPackageKeys returns the keys of all the packages, already listed in the given sequence
+func seenPackageKeys(seq *yaml.Node) map[string]struct{} {
+	seen := make(map[string]struct{}, len(seq.Content))
+	for _, item := range seq.Content {
+		var pkg NormalizedPackage
+		if err := item.Decode(&pkg); err != nil {
+			continue
+		}
+		seen[packageKey(&pkg)] = struct{}{}
+	}
+	return seen
+}
+
+// AddPackages adds nix packages (or libraries) to the nixy file,
+// preserving user's comments and ordering
+func AddPackages(file string, pkgs []string, asLibrary bool) error {
+	ef, err := openEditableNixyFile(file)
+	if err != nil {
+		return err
+	}
+
+	key, kind, afterKey := "packages", "package", "nixpkgs"
+	if asLibrary {
+		key, kind, afterKey = "libraries", "library", "packages"
+	}
+
+	seq := ef.sequence(key, afterKey)
+	seen := seenPackageKeys(seq)
+
+	// INFO: nixpkgs keys can come from imported files too, as with validate
+	nixpkgsKeys := importedNixPkgsKeys(file, map[string]bool{})
+
+	added := make([]*yaml.Node, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		np, err := parseNixPackage(pkg)
+		if err != nil {
+			return err
+		}
+
+		if np.NixPackage.Commit != "" {
+			if !slices.Contains(nixpkgsKeys, np.NixPackage.Commit) {
+				return fmt.Errorf("%s %q refers to nixpkgs key %q, which is not defined in nixpkgs (%s, or its imports)", kind, pkg, np.NixPackage.Commit, file)
+			}
+		}
+
+		if _, ok := seen[packageKey(np)]; ok {
+			return fmt.Errorf("%s %q is already present in %s", kind, np.NixPackage.Name, file)
+		}
+		seen[packageKey(np)] = struct{}{}
+
+		added = append(added, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: pkg})
+	}
+
+	seq.Content = append(seq.Content, added...)
+
+	return ef.sync()
+}
+
+// RemovePackages removes packages (or libraries) from the nixy file, either by their name
+// or as written in nixy.yml (e.g. unstable#ripgrep), preserving user's comments and ordering
+func RemovePackages(file string, names []string, asLibrary bool) error {
+	ef, err := openEditableNixyFile(file)
+	if err != nil {
+		return err
+	}
+
+	key, kind := "packages", "package"
+	if asLibrary {
+		key, kind = "libraries", "library"
+	}
+
+	seq := findMappingValue(ef.docNode, key)
+	if seq == nil || seq.Kind != yaml.SequenceNode {
+		return fmt.Errorf("%s has no %s", file, key)
+	}
+
+	matches := func(item *yaml.Node, name string) bool {
+		var pkg NormalizedPackage
+		if err := item.Decode(&pkg); err != nil {
+			return false
+		}
+		return item.Value == name || packageKey(&pkg) == name
+	}
+
+	for _, name := range names {
+		count := len(seq.Content)
+		seq.Content = slices.DeleteFunc(seq.Content, func(item *yaml.Node) bool { return matches(item, name) })
+		if len(seq.Content) == count {
+			return fmt.Errorf("%s %q is not present in %s", kind, name, file)
+		}
+	}
+
+	return ef.sync()
+}
@@ -0,0 +1,170 @@
+package nixy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const editTestInput = `# This is a top comment
+nixpkgs:
+  # default nixpkgs version
+  default: "abc123"
+  unstable: "def456"
+packages:
+  - go # Go compiler
+  - nodejs
+# Shell hooks
+onShellEnter: |
+  export PATH="$PWD/bin:$PATH"
+`
+
+func writeEditTestFile(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "nixy.yml")
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write nixy file: %v", err)
+	}
+	return file
+}
+
+func readEditTestFile(t *testing.T, file string) string {
+	t.Helper()
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to read nixy file: %v", err)
+	}
+	return string(b)
+}
+
+func TestAddPackages(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		pkgs      []string
+		asLibrary bool
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:  "adds packages, preserving comments",
+			input: editTestInput,
+			pkgs:  []string{"go_1_22", "unstable#ripgrep"},
+			want: `# This is a top comment
+nixpkgs:
+  # default nixpkgs version
+  default: "abc123"
+  unstable: "def456"
+packages:
+  - go # Go compiler
+  - nodejs
+  - go_1_22
+  - unstable#ripgrep
+# Shell hooks
+onShellEnter: |
+  export PATH="$PWD/bin:$PATH"
+`,
+		},
+		{
+			name:      "adds libraries, when not present",
+			input:     editTestInput,
+			pkgs:      []string{"openssl"},
+			asLibrary: true,
+			want: `# This is a top comment
+nixpkgs:
+  # default nixpkgs version
+  default: "abc123"
+  unstable: "def456"
+packages:
+  - go # Go compiler
+  - nodejs
+libraries:
+  - openssl
+# Shell hooks
+onShellEnter: |
+  export PATH="$PWD/bin:$PATH"
+`,
+		},
+		{
+			name:    "rejects undefined nixpkgs key",
+			input:   editTestInput,
+			pkgs:    []string{"stable#ripgrep"},
+			wantErr: true,
+		},
+		{
+			name:    "rejects duplicate packages",
+			input:   editTestInput,
+			pkgs:    []string{"unstable#nodejs"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeEditTestFile(t, tt.input)
+
+			err := AddPackages(file, tt.pkgs, tt.asLibrary)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("wanted error, but got no error")
+				}
+
+				if got := readEditTestFile(t, file); got != tt.input {
+					t.Errorf("file must not change on error, got:\n%s", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := readEditTestFile(t, file); got != tt.want {
+				t.Errorf("mismatch:\ngot:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemovePackages(t *testing.T) {
+	file := writeEditTestFile(t, editTestInput)
+
+	if err := RemovePackages(file, []string{"nodejs"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `# This is a top comment
+nixpkgs:
+  # default nixpkgs version
+  default: "abc123"
+  unstable: "def456"
+packages:
+  - go # Go compiler
+# Shell hooks
+onShellEnter: |
+  export PATH="$PWD/bin:$PATH"
+`
+
+	if got := readEditTestFile(t, file); got != want {
+		t.Errorf("mismatch:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	if err := RemovePackages(file, []string{"nodejs"}, false); err == nil {
+		t.Errorf("wanted error removing a package that is not present, but got no error")
+	}
+}
+
+func TestAddPackages_ImportedNixPkgsKey(t *testing.T) {
+	file := writeEditTestFile(t, "imports: [./common.yml]\npackages:\n  - go\n")
+	if err := os.WriteFile(filepath.Join(filepath.Dir(file), "common.yml"), []byte("nixpkgs:\n  default: abc123\n  unstable: def456\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AddPackages(file, []string{"unstable#ripgrep"}, false); err != nil {
+		t.Fatalf("nixpkgs key from an imported file must be accepted, got error: %v", err)
+	}
+
+	if err := AddPackages(file, []string{"stable#ripgrep"}, false); err == nil {
+		t.Errorf("wanted error for a nixpkgs key defined nowhere, but got no error")
+	}
+}
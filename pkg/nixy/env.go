@@ -0,0 +1,138 @@
+package nixy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// EnvFormats are the formats, that the workspace env could be printed in
+var EnvFormats = []string{"dotenv", "json", "shell", "fish", "github-actions"}
+
+const envOutputMarker = "\x00__NIXY_ENV__\x00"
+
+// ignoredEnvVars are set by the shell itself, or by nixy to run the shell, and are not part of the workspace env.
+// temp dirs are created by print-dev-env for the shell, and do not outlive it
+var ignoredEnvVars = []string{"_", "SHLVL", "PWD", "OLDPWD", "NIXY_SHELL", "TMP", "TMPDIR", "TEMP", "TEMPDIR", "NIX_BUILD_TOP"}
+
+// WorkspaceEnv evaluates the workspace env, just like `nixy shell` (i.e. nix print-dev-env and user's env),
+// and returns the env vars, that differ from the current process' env
+func (n *NixyWrapper) WorkspaceEnv(ctx *Context) (map[string]string, error) {
+	// INFO: shellHook could print to stdout, so actual env is printed after a marker
+	cmd, err := n.nixShellExec(ctx, fmt.Sprintf("printf '%s'; env -0", strings.ReplaceAll(envOutputMarker, "\x00", `\0`)))
+	if err != nil {
+		return nil, err
+	}
+
+	stdout := new(bytes.Buffer)
+	cmd.Stdin = nil
+	cmd.Stdout = stdout
+
+	slog.Debug("Evaluating workspace env", "command", cmd.String())
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	_, out, ok := bytes.Cut(stdout.Bytes(), []byte(envOutputMarker))
+	if !ok {
+		return nil, fmt.Errorf("failed to read workspace env, from nixy shell's output")
+	}
+
+	return diffEnv(environToMap(os.Environ()), parseNullSeparatedEnv(out)), nil
+}
+
+func parseNullSeparatedEnv(b []byte) map[string]string {
+	env := map[string]string{}
+	for item := range bytes.SplitSeq(b, []byte{0}) {
+		k, v, ok := bytes.Cut(item, []byte("="))
+		if !ok || len(k) == 0 {
+			continue
+		}
+		env[string(k)] = string(v)
+	}
+	return env
+}
+
+func environToMap(environ []string) map[string]string {
+	env := make(map[string]string, len(environ))
+	for _, item := range environ {
+		if k, v, ok := strings.Cut(item, "="); ok {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// diffEnv returns env vars from after, that are either new or changed from before
+func diffEnv(before, after map[string]string) map[string]string {
+	diff := make(map[string]string)
+	for k, v := range after {
+		if slices.Contains(ignoredEnvVars, k) {
+			continue
+		}
+
+		if old, ok := before[k]; ok && old == v {
+			continue
+		}
+		diff[k] = v
+	}
+	return diff
+}
+
+// FormatEnv renders env in one of the EnvFormats
+func FormatEnv(env map[string]string, format string) (string, error) {
+	keys := slices.Sorted(maps.Keys(env))
+
+	b := new(strings.Builder)
+	switch format {
+	case "dotenv":
+		r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`)
+		for _, k := range keys {
+			fmt.Fprintf(b, "%s=\"%s\"\n", k, r.Replace(env[k]))
+		}
+	case "json":
+		out, err := json.MarshalIndent(env, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		b.Write(out)
+		b.WriteString("\n")
+	case "shell":
+		for _, k := range keys {
+			fmt.Fprintf(b, "export %s=%s\n", k, shellQuote(env[k]))
+		}
+	case "fish":
+		for _, k := range keys {
+			fmt.Fprintf(b, "set -gx %s %s\n", k, fishQuote(env[k]))
+		}
+	case "github-actions":
+		// [READ about multiline strings](https://docs.github.com/en/actions/writing-workflows/choosing-what-your-workflow-does/workflow-commands-for-github-actions#multiline-strings)
+		for _, k := range keys {
+			v := env[k]
+			if !strings.Contains(v, "\n") {
+				fmt.Fprintf(b, "%s=%s\n", k, v)
+				continue
+			}
+
+			delimiter := "NIXY_EOF"
+			for strings.Contains(v, delimiter) {
+				delimiter += "_"
+			}
+			fmt.Fprintf(b, "%s<<%s\n%s\n%s\n", k, delimiter, v, delimiter)
+		}
+	default:
+		return "", fmt.Errorf("unsupported env format %q (supported: %s)", format, strings.Join(EnvFormats, ", "))
+	}
+
+	return b.String(), nil
+}
+
+// fishQuote quotes s for fish shell, where only \ and ' need escaping inside single quotes
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,93 @@
+package nixy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFormatEnv(t *testing.T) {
+	env := map[string]string{
+		"PATH":    "/nix/store/abc/bin:/usr/bin",
+		"MESSAGE": "it's \"quoted\" $HOME",
+		"CERT":    "line1\nline2",
+	}
+
+	tests := []struct {
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{
+			format: "dotenv",
+			want: `CERT="line1\nline2"
+MESSAGE="it's \"quoted\" \$HOME"
+PATH="/nix/store/abc/bin:/usr/bin"
+`,
+		},
+		{
+			format: "json",
+			want: `{
+  "CERT": "line1\nline2",
+  "MESSAGE": "it's \"quoted\" $HOME",
+  "PATH": "/nix/store/abc/bin:/usr/bin"
+}
+`,
+		},
+		{
+			format: "shell",
+			want: `export CERT='line1
+line2'
+export MESSAGE='it'\''s "quoted" $HOME'
+export PATH='/nix/store/abc/bin:/usr/bin'
+`,
+		},
+		{
+			format: "fish",
+			want: `set -gx CERT 'line1
+line2'
+set -gx MESSAGE 'it\'s "quoted" $HOME'
+set -gx PATH '/nix/store/abc/bin:/usr/bin'
+`,
+		},
+		{
+			format: "github-actions",
+			want: `CERT<<NIXY_EOF
+line1
+line2
+NIXY_EOF
+MESSAGE=it's "quoted" $HOME
+PATH=/nix/store/abc/bin:/usr/bin
+`,
+		},
+		{
+			format:  "yaml",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			got, err := FormatEnv(env, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FormatEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("FormatEnv()\ngot:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffEnv(t *testing.T) {
+	before := environToMap([]string{"HOME=/home/user", "PATH=/usr/bin", "SHLVL=1"})
+	after := parseNullSeparatedEnv([]byte("HOME=/home/user\x00PATH=/nix/store/abc/bin:/usr/bin\x00SHLVL=2\x00NIXY_SHELL=true\x00GREETING=a=b\x00"))
+
+	want := map[string]string{
+		"PATH":     "/nix/store/abc/bin:/usr/bin",
+		"GREETING": "a=b",
+	}
+
+	if got := diffEnv(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("diffEnv() = %v, want %v", got, want)
+	}
+}
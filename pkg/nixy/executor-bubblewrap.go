@@ -50,12 +50,21 @@ func exists(path string) bool {
 	return false
 }
 
-func (nixy *NixyWrapper) bubblewrapShell(ctx *Context, command string, args ...string) (*exec.Cmd, error) {
-	isWorktreeEnabled, workspaceDir, _ := GitWorktreeEnabledWorkspace(ctx, ctx.PWD)
-	if isWorktreeEnabled {
-		nixy.executorArgs.EnvVars.NixyWorkspaceLabel = filepath.Base(workspaceDir) + ctx.PWD[len(workspaceDir):]
-	}
+type bubblewrapExecutor struct{}
+
+func (e *bubblewrapExecutor) Setup(ctx *Context, runtimePaths *RuntimePaths) (*ExecutorArgs, error) {
+	return UseBubbleWrap(ctx, runtimePaths)
+}
+
+func (e *bubblewrapExecutor) Mounts(ctx *Context, nixy *NixyWrapper, workspaceDir string) ([]ExecutorMountPath, error) {
+	return nixy.sandboxMounts(ctx, workspaceDir)
+}
+
+func (e *bubblewrapExecutor) Environ(ctx *Context, args *ExecutorArgs) []string {
+	return args.EnvVars.ToEnviron(ctx)
+}
 
+func (e *bubblewrapExecutor) Command(ctx *Context, c *ExecutorCommand) (*exec.Cmd, error) {
 	bwrapArgs := []string{
 		// no-zombie processes
 		// "--clearenv",
@@ -85,87 +94,23 @@ func (nixy *NixyWrapper) bubblewrapShell(ctx *Context, command string, args ...s
 		"--setenv", "PATH", "/nixy",
 		"--tmpfs", "/bin",
 		"--tmpfs", "/usr",
-		"--ro-bind", nixy.runtimePaths.StaticNixBinPath, "/nixy/nix",
-		"--ro-bind", ctx.NixyBinPath, "/nixy/nixy",
-
-		// STEP: read-write binds
-		"--ro-bind", nixy.runtimePaths.BasePath, nixy.executorArgs.ProfileDirMountedPath,
-
-		// Custom User Home for nixy BubbleWrap shell
-		"--bind", nixy.runtimePaths.FakeHomeDir, nixy.executorArgs.FakeHomeMountedPath,
-		"--setenv", "HOME", nixy.executorArgs.FakeHomeMountedPath,
-		"--bind", nixy.executorArgs.WorkspaceFlakeDirHostPath, nixy.executorArgs.WorkspaceFlakeDirMountedPath,
-
-		// Nix Store for nixy bubblewrap shell
-		"--bind", nixy.runtimePaths.NixDir, nixy.executorArgs.NixDirMountedPath,
-
-		// Current Working Directory as it is
-		"--bind", workspaceDir, workspaceDir,
-
-		// INFO: it is just to keep the workspace at /workspace in the sandbox
-		"--bind", workspaceDir, WorkspaceDirSandboxMountPath,
-	}
-
-	// Mount terminfo if TERMINFO env var is set
-	if terminfo := os.Getenv("TERMINFO"); terminfo != "" {
-		bwrapArgs = append(bwrapArgs,
-			"--tmpfs", nixy.executorArgs.EnvVars.TermInfo,
-			"--ro-bind", terminfo, nixy.executorArgs.EnvVars.TermInfo,
-		)
-	}
-
-	mounts := nixy.Mounts
-	if ctx.NixyUseProfile {
-		mounts = append(mounts, nixy.profileNixy.Mounts...)
 	}
 
-	executorEnv := nixy.executorArgs.EnvVars.toMap(ctx)
-
-	for _, mount := range mounts {
+	for _, mount := range c.Mounts {
 		flag := "--bind"
 		if mount.ReadOnly {
 			flag = "--ro-bind"
 		}
 
-		src := os.ExpandEnv(mount.Source)
-		dst := os.Expand(mount.Destination, func(s string) string {
-			if v, ok := executorEnv[s]; ok {
-				return v
-			}
-
-			if v, ok := nixy.Env[s]; ok {
-				return v
-			}
-
-			if nixy.profileNixy != nil {
-				if v, ok := nixy.profileNixy.Env[s]; ok {
-					return v
-				}
-			}
-
-			// Return original $VAR syntax if not found, so errors are visible
-			return "$" + s
-		})
-
-		if src == "" || dst == "" {
-			return nil, fmt.Errorf("mount has empty source or destination: source=%q, dest=%q (original: %q -> %q)", src, dst, mount.Source, mount.Destination)
-		}
-
-		bwrapArgs = append(bwrapArgs, flag, src, dst)
+		bwrapArgs = append(bwrapArgs, flag, mount.HostPath, mount.MountPath)
 	}
 
-	for k, v := range nixy.executorArgs.EnvVars.toMap(ctx) {
+	for k, v := range c.Env {
 		bwrapArgs = append(bwrapArgs, "--setenv", k, v)
 	}
 
-	bwrapArgs = append(bwrapArgs, command)
-	bwrapArgs = append(bwrapArgs, args...)
-
-	if !exists(nixy.runtimePaths.StaticNixBinPath) {
-		if err := downloadStaticNixBinary(ctx, nixy.runtimePaths.StaticNixBinPath); err != nil {
-			return nil, err
-		}
-	}
+	bwrapArgs = append(bwrapArgs, c.Command)
+	bwrapArgs = append(bwrapArgs, c.Args...)
 
 	return exec.CommandContext(ctx, "bwrap", bwrapArgs...), nil
 }
@@ -38,98 +38,67 @@ func UseDocker(ctx *Context, runtimePaths *RuntimePaths) (*ExecutorArgs, error)
 	return &dockerCfg, nil
 }
 
-func (nixy *NixyWrapper) dockerShell(ctx *Context, command string, args ...string) (*exec.Cmd, error) {
-	isWorktreeEnabled, workspaceDir, _ := GitWorktreeEnabledWorkspace(ctx, ctx.PWD)
-	if isWorktreeEnabled {
-		nixy.executorArgs.EnvVars.NixyWorkspaceLabel = filepath.Base(workspaceDir) + ctx.PWD[len(workspaceDir):]
+type dockerExecutor struct{}
+
+func (e *dockerExecutor) Setup(ctx *Context, runtimePaths *RuntimePaths) (*ExecutorArgs, error) {
+	return UseDocker(ctx, runtimePaths)
+}
+
+func (e *dockerExecutor) Mounts(ctx *Context, nixy *NixyWrapper, workspaceDir string) ([]ExecutorMountPath, error) {
+	return nixy.sandboxMounts(ctx, workspaceDir)
+}
+
+func (e *dockerExecutor) Environ(ctx *Context, args *ExecutorArgs) []string {
+	return args.EnvVars.ToEnviron(ctx)
+}
+
+// containerVolume is the mount as docker (or podman) -v flag, i.e. src:dest[:ro,z]
+func containerVolume(mount ExecutorMountPath) string {
+	var attrs []string
+	if mount.ReadOnly {
+		attrs = append(attrs, "ro")
+	}
+	if mount.Label != SELinuxLabelNone {
+		attrs = append(attrs, string(mount.Label))
 	}
 
-	addMount := func(src, dest string, flags ...string) string {
-		return fmt.Sprintf("%s:%s:%s", src, dest, strings.Join(flags, ","))
+	if len(attrs) == 0 {
+		return fmt.Sprintf("%s:%s", mount.HostPath, mount.MountPath)
 	}
+	return fmt.Sprintf("%s:%s:%s", mount.HostPath, mount.MountPath, strings.Join(attrs, ","))
+}
 
+func (e *dockerExecutor) Command(ctx *Context, c *ExecutorCommand) (*exec.Cmd, error) {
 	dockerCmd := []string{
 		"docker", "run",
 		"--hostname", "nixy",
 		"--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
 
-		// STEP: profile flake dir
-		"-v", addMount(nixy.runtimePaths.BasePath, nixy.executorArgs.ProfileDirMountedPath, "z"),
-
-		// Mount Home
-		"-v", addMount(nixy.runtimePaths.FakeHomeDir, nixy.executorArgs.FakeHomeMountedPath, "z"),
-		"-e", "HOME=" + nixy.executorArgs.FakeHomeMountedPath,
-
-		// Mount current flake directory
-		"-v", addMount(nixy.executorArgs.WorkspaceFlakeDirHostPath, nixy.executorArgs.WorkspaceFlakeDirMountedPath, "Z"),
-
 		// STEP: nixy and nix binary mounts
 		"--tmpfs", "/nixy:ro",
 		"-e", "PATH=/nixy",
 		"--tmpfs", fmt.Sprintf("/bin:rw,uid=%d,gid=%d", os.Getuid(), os.Getgid()),
 		"--tmpfs", fmt.Sprintf("/usr:rw,uid=%d,gid=%d", os.Getuid(), os.Getgid()),
-		"-v", addMount(ctx.NixyBinPath, "/nixy/nixy", "ro", "z"),
-		"-v", addMount(nixy.runtimePaths.StaticNixBinPath, "/nixy/nix", "ro", "z"),
-
-		// STEP: Nix Store
-		"-v", addMount(nixy.runtimePaths.NixDir, nixy.executorArgs.NixDirMountedPath, "z"),
-
-		// STEP: project dir
-		"-v", addMount(workspaceDir, workspaceDir, "Z"),
-		"-v", addMount(workspaceDir, WorkspaceDirSandboxMountPath, "Z"),
-	}
-
-	// Mount terminfo if TERMINFO env var is set
-	if terminfo := os.Getenv("TERMINFO"); terminfo != "" {
-		dockerCmd = append(dockerCmd,
-			"-v", addMount(terminfo, nixy.executorArgs.EnvVars.TermInfo, "ro", "z"),
-		)
-	}
-
-	mounts := nixy.Mounts
-	if ctx.NixyUseProfile {
-		mounts = append(mounts, nixy.profileNixy.Mounts...)
 	}
 
-	nixyShellEnvExpander := func(key string) string {
-		slog.Info("nixy profile", "env", nixy.profileNixy.Env)
-		if v, ok := nixy.profileNixy.Env[key]; ok {
-			return os.ExpandEnv(v)
-		}
-
-		switch key {
-			case "HOME":
-				return nixy.executorArgs.FakeHomeMountedPath
-			default:
-				return ""
-		}
+	for _, mount := range c.Mounts {
+		dockerCmd = append(dockerCmd, "-v", containerVolume(mount))
 	}
 
-	for _, mount := range mounts {
-		attrs := []string{"z"}
-		if mount.ReadOnly {
-			attrs = append(attrs, "ro")
-		}
-
-		dockerCmd = append(dockerCmd, "-v", addMount(os.ExpandEnv(mount.Source), os.Expand(mount.Destination, nixyShellEnvExpander), attrs...))
-	}
-
-	for k, v := range nixy.executorArgs.EnvVars.toMap(ctx) {
+	for k, v := range c.Env {
 		dockerCmd = append(dockerCmd, "-e", k+"="+v)
 	}
 
-	if !exists(nixy.runtimePaths.StaticNixBinPath) {
-		if err := downloadStaticNixBinary(ctx, nixy.runtimePaths.StaticNixBinPath); err != nil {
-			return nil, err
-		}
+	dockerCmd = append(dockerCmd, "--rm", "-i")
+	// INFO: allocating a tty, without one on stdin fails (e.g. in CI pipelines)
+	if c.TTY {
+		dockerCmd = append(dockerCmd, "-t")
 	}
+	dockerCmd = append(dockerCmd, "gcr.io/distroless/static-debian12")
+	dockerCmd = append(dockerCmd, c.Command)
+	dockerCmd = append(dockerCmd, c.Args...)
 
-	dockerCmd = append(dockerCmd, "--rm", "-it", "gcr.io/distroless/static-debian12")
-	dockerCmd = append(dockerCmd, command)
-	dockerCmd = append(dockerCmd, args...)
-
-	slog.Info("HERE ...", "docker-cmd", dockerCmd)
-
+	slog.Debug("docker", "cmd", dockerCmd)
 
 	return exec.CommandContext(ctx, dockerCmd[0], dockerCmd[1:]...), nil
 }
@@ -0,0 +1,96 @@
+package nixy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// externalExecutorPrefix is the prefix of external executor binaries, i.e. NIXY_EXECUTOR=gvisor runs nixy-executor-gvisor
+const externalExecutorPrefix = "nixy-executor-"
+
+// externalExecutorProtocolVersion is bumped, whenever the request or the response changes incompatibly
+const externalExecutorProtocolVersion = 1
+
+// ExternalExecutorRequest is written as JSON to stdin of `nixy-executor-<name> prepare`
+type ExternalExecutorRequest struct {
+	Version  int    `json:"version"`
+	Executor string `json:"executor"`
+
+	ExecutorCommand
+}
+
+// ExternalExecutorResponse is read as JSON from stdout of `nixy-executor-<name> prepare`
+type ExternalExecutorResponse struct {
+	// Argv is the command (and its args), nixy runs to run the request's command inside the sandbox
+	Argv []string `json:"argv"`
+
+	// Env (as KEY=VALUE) is added to nixy's own env, for Argv. Env inside the sandbox is the request's Env
+	Env []string `json:"env,omitempty"`
+}
+
+// externalExecutor is a nixy-executor-<name> binary on PATH, that translates a command (with its mounts and env),
+// into the command running it inside a sandbox. The sandbox layout is the same as of docker executor
+type externalExecutor struct {
+	name    string
+	binPath string
+}
+
+func (e *externalExecutor) Setup(ctx *Context, runtimePaths *RuntimePaths) (*ExecutorArgs, error) {
+	return UseDocker(ctx, runtimePaths)
+}
+
+func (e *externalExecutor) Mounts(ctx *Context, nixy *NixyWrapper, workspaceDir string) ([]ExecutorMountPath, error) {
+	return nixy.sandboxMounts(ctx, workspaceDir)
+}
+
+// Environ is nil, as Command sets the env (nixy's own, along with the response's) already
+func (e *externalExecutor) Environ(ctx *Context, args *ExecutorArgs) []string {
+	return nil
+}
+
+func (e *externalExecutor) Command(ctx *Context, c *ExecutorCommand) (*exec.Cmd, error) {
+	req, err := json.Marshal(ExternalExecutorRequest{
+		Version:         externalExecutorProtocolVersion,
+		Executor:        e.name,
+		ExecutorCommand: *c,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	prepare := exec.CommandContext(ctx, e.binPath, "prepare")
+	prepare.Stdin = bytes.NewReader(req)
+	prepare.Stdout = &stdout
+	prepare.Stderr = &stderr
+
+	if err := prepare.Run(); err != nil {
+		return nil, fmt.Errorf("executor %s (%s) failed to prepare command: %w: %s", e.name, e.binPath, err, strings.TrimSpace(stderr.String()))
+	}
+
+	resp, err := parseExternalExecutorResponse(stdout.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("executor %s (%s): %w", e.name, e.binPath, err)
+	}
+
+	cmd := exec.CommandContext(ctx, resp.Argv[0], resp.Argv[1:]...)
+	cmd.Env = append(os.Environ(), resp.Env...)
+	return cmd, nil
+}
+
+func parseExternalExecutorResponse(b []byte) (*ExternalExecutorResponse, error) {
+	var resp ExternalExecutorResponse
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+
+	if len(resp.Argv) == 0 {
+		return nil, fmt.Errorf("invalid response: argv must not be empty")
+	}
+
+	return &resp, nil
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 )
 
 func deriveWorkspacePath(workspacesDir, cwd string) string {
@@ -18,7 +19,7 @@ func UseLocal(ctx *Context, runtimePaths *RuntimePaths) (*ExecutorArgs, error) {
 	nixPath, err := exec.LookPath("nix")
 	if err != nil {
 		if errors.Is(err, exec.ErrNotFound) {
-			return nil, fmt.Errorf("nix is not installed on your machine. Please follow docs over `https://nixos.org/download/` to install nix on your machine")
+			return nil, &ExitError{Code: ExitCodeNixNotFound, Err: fmt.Errorf("nix is not installed on your machine. Please follow docs over `https://nixos.org/download/` to install nix on your machine")}
 		}
 	}
 
@@ -53,13 +54,37 @@ func UseLocal(ctx *Context, runtimePaths *RuntimePaths) (*ExecutorArgs, error) {
 	}, nil
 }
 
-func (nixy *NixyWrapper) localShell(ctx *Context, command string, args ...string) (*exec.Cmd, error) {
-	isWorktreeEnabled, workspaceDir, _ := GitWorktreeEnabledWorkspace(ctx, ctx.PWD)
-	if isWorktreeEnabled {
-		nixy.executorArgs.EnvVars.NixyWorkspaceLabel = filepath.Base(workspaceDir) + ctx.PWD[len(workspaceDir):]
+// localExecutor runs nix on the host. With ignoreEnv, the host env is not inherited (i.e. local-ignore-env)
+type localExecutor struct {
+	ignoreEnv bool
+}
+
+func (e *localExecutor) Setup(ctx *Context, runtimePaths *RuntimePaths) (*ExecutorArgs, error) {
+	return UseLocal(ctx, runtimePaths)
+}
+
+func (e *localExecutor) Mounts(ctx *Context, nixy *NixyWrapper, workspaceDir string) ([]ExecutorMountPath, error) {
+	return nil, nil
+}
+
+func (e *localExecutor) Environ(ctx *Context, args *ExecutorArgs) []string {
+	if e.ignoreEnv {
+		return args.EnvVars.ToEnviron(ctx)
 	}
 
-	cmd := exec.CommandContext(ctx, command, args...)
+	// INFO: host env is kept as is (e.g. HOME, XDG_*), only nixy's own vars are added, as nixy commands
+	// inside the shell (e.g. nixy run, nixy exec) need them (like NIXY_WORKSPACE_DIR and NIXY_FILE)
+	environ := os.Environ()
+	for k, v := range args.EnvVars.toMap(ctx) {
+		if strings.HasPrefix(k, "NIXY_") && v != "" {
+			environ = append(environ, k+"="+v)
+		}
+	}
+	return environ
+}
+
+func (e *localExecutor) Command(ctx *Context, c *ExecutorCommand) (*exec.Cmd, error) {
+	cmd := exec.CommandContext(ctx, c.Command, c.Args...)
 	cmd.Env = append(cmd.Env, fmt.Sprintf("PATH=%s:%s", filepath.Dir(ctx.NixyBinPath), os.Getenv("PATH")))
 	return cmd, nil
 }
@@ -0,0 +1,96 @@
+package nixy
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+func UsePodman(ctx *Context, runtimePaths *RuntimePaths) (*ExecutorArgs, error) {
+	fakeHomeMountedPath := "/home/nixy"
+
+	podmanCfg := ExecutorArgs{
+		NixBinaryMountedPath:         "/nixy/nix",
+		ProfileDirMountedPath:        "/profile",
+		FakeHomeMountedPath:          fakeHomeMountedPath,
+		NixDirMountedPath:            "/nix",
+		WorkspaceFlakeDirMountedPath: WorkspaceFlakeSandboxMountPath,
+		WorkspaceFlakeDirHostPath:    deriveWorkspacePath(runtimePaths.WorkspacesDir, ctx.PWD),
+
+		EnvVars: executorEnvVars{
+			User:                  "nixy",
+			Home:                  fakeHomeMountedPath,
+			Term:                  os.Getenv("TERM"),
+			TermInfo:              "/terminfo",
+			XDGSessionType:        os.Getenv("XDG_SESSION_TYPE"),
+			XDGCacheHome:          filepath.Join(fakeHomeMountedPath, ".cache"),
+			XDGDataHome:           filepath.Join(fakeHomeMountedPath, ".local", "share"),
+			NixyWorkspaceDir:      ctx.PWD,
+			NixyWorkspaceLabel:    filepath.Base(ctx.PWD),
+			NixyWorkspaceFlakeDir: WorkspaceFlakeSandboxMountPath,
+			NixConfDir:            filepath.Join(runtimePaths.FakeHomeDir, ".config", "nix"),
+		},
+	}
+
+	return &podmanCfg, nil
+}
+
+type podmanExecutor struct{}
+
+func (e *podmanExecutor) Setup(ctx *Context, runtimePaths *RuntimePaths) (*ExecutorArgs, error) {
+	return UsePodman(ctx, runtimePaths)
+}
+
+func (e *podmanExecutor) Mounts(ctx *Context, nixy *NixyWrapper, workspaceDir string) ([]ExecutorMountPath, error) {
+	return nixy.sandboxMounts(ctx, workspaceDir)
+}
+
+func (e *podmanExecutor) Environ(ctx *Context, args *ExecutorArgs) []string {
+	return args.EnvVars.ToEnviron(ctx)
+}
+
+func (e *podmanExecutor) Command(ctx *Context, c *ExecutorCommand) (*exec.Cmd, error) {
+	podmanCmd := []string{
+		"podman", "run",
+		"--hostname", "nixy",
+	}
+
+	// INFO: keep-id maps the host user to the same uid/gid in the container (rootless podman),
+	// so files created in the workspace and fake-home are owned by the host user.
+	// podman run as root is rootful, where keep-id fails, and root is root in the container anyway
+	if os.Geteuid() != 0 {
+		podmanCmd = append(podmanCmd, "--userns=keep-id")
+	}
+
+	podmanCmd = append(podmanCmd,
+		// STEP: nixy and nix binary mounts
+		"--tmpfs", "/nixy:ro",
+		"-e", "PATH=/nixy",
+		"--tmpfs", fmt.Sprintf("/bin:rw,uid=%d,gid=%d", os.Getuid(), os.Getgid()),
+		"--tmpfs", fmt.Sprintf("/usr:rw,uid=%d,gid=%d", os.Getuid(), os.Getgid()),
+	)
+
+	// INFO: SELinux confinement stays on, nixy owned dirs and workspace dirs are relabeled (as with docker), user mounts are not
+	for _, mount := range c.Mounts {
+		podmanCmd = append(podmanCmd, "-v", containerVolume(mount))
+	}
+
+	for k, v := range c.Env {
+		podmanCmd = append(podmanCmd, "-e", k+"="+v)
+	}
+
+	podmanCmd = append(podmanCmd, "--rm", "-i")
+	// INFO: allocating a tty, without one on stdin fails (e.g. in CI pipelines)
+	if c.TTY {
+		podmanCmd = append(podmanCmd, "-t")
+	}
+	podmanCmd = append(podmanCmd, "gcr.io/distroless/static-debian12")
+	podmanCmd = append(podmanCmd, c.Command)
+	podmanCmd = append(podmanCmd, c.Args...)
+
+	slog.Debug("podman", "cmd", podmanCmd)
+
+	return exec.CommandContext(ctx, podmanCmd[0], podmanCmd[1:]...), nil
+}
@@ -9,6 +9,10 @@ import (
 	"log/slog"
 	"context"
 	"bytes"
+	"slices"
+	"strings"
+
+	"golang.org/x/term"
 )
 
 func XDGDataDir() string {
@@ -52,20 +56,174 @@ func GitWorktreeEnabledWorkspace(ctx context.Context, dir string) (bool, string,
 	return isWorktree, workspaceDir, nil
 }
 
+// Executor runs nix (and so, the workspace shell) on the host, or inside a sandbox
+type Executor interface {
+	// Setup returns where nix, profile, fake-home and workspace flake dirs are, as seen by the executor, along with its env vars
+	Setup(ctx *Context, runtimePaths *RuntimePaths) (*ExecutorArgs, error)
+
+	// Mounts plans the host paths, to be made available inside the executor. Executors running on the host, return none
+	Mounts(ctx *Context, nixy *NixyWrapper, workspaceDir string) ([]ExecutorMountPath, error)
+
+	// Environ returns env (as KEY=VALUE) of the process, that Command prepares
+	Environ(ctx *Context, args *ExecutorArgs) []string
+
+	// Command prepares the command, that runs c.Command with c.Args inside the executor
+	Command(ctx *Context, c *ExecutorCommand) (*exec.Cmd, error)
+}
+
+// ExecutorCommand is everything an executor needs, to prepare a command
+type ExecutorCommand struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+
+	// Env is to be set inside the executor
+	Env map[string]string `json:"env"`
+
+	Mounts []ExecutorMountPath `json:"mounts"`
+
+	// WorkspaceDir is the project dir, or the bare repository, for git worktrees
+	WorkspaceDir string `json:"workspaceDir"`
+
+	// TTY tells whether stdin is a terminal
+	TTY bool `json:"tty"`
+}
+
+var executors = map[Mode]Executor{
+	LocalMode:          &localExecutor{},
+	LocalIgnoreEnvMode: &localExecutor{ignoreEnv: true},
+	DockerMode:         &dockerExecutor{},
+	PodmanMode:         &podmanExecutor{},
+	BubbleWrapMode:     &bubblewrapExecutor{},
+}
+
+// RegisterExecutor makes e available as NIXY_EXECUTOR=<mode>, replacing any executor already registered for mode
+func RegisterExecutor(mode Mode, e Executor) {
+	executors[mode] = e
+}
+
+// lookupExecutor returns the executor registered for mode, or else an external nixy-executor-<mode> binary on PATH
+func lookupExecutor(mode Mode) (Executor, error) {
+	if e, ok := executors[mode]; ok {
+		return e, nil
+	}
+
+	if binPath, err := exec.LookPath(externalExecutorPrefix + string(mode)); err == nil {
+		return &externalExecutor{name: string(mode), binPath: binPath}, nil
+	}
+
+	supported := make([]string, 0, len(executors))
+	for m := range executors {
+		supported = append(supported, string(m))
+	}
+	slices.Sort(supported)
+
+	return nil, &ExitError{
+		Code: ExitCodeConfig,
+		Err:  fmt.Errorf("unknown executor: %s, supported executors are %s, or a %s%s binary on PATH", mode, strings.Join(supported, ", "), externalExecutorPrefix, mode),
+	}
+}
+
 func (nixy *NixyWrapper) PrepareShellCommand(ctx *Context, command string, args ...string) (*exec.Cmd, error) {
-	switch ctx.NixyMode {
-	case LocalMode:
-		return nixy.localShell(ctx, command, args...)
-	case LocalIgnoreEnvMode:
-		return nixy.localShell(ctx, command, args...)
-	case DockerMode:
-		return nixy.dockerShell(ctx, command, args...)
-	case BubbleWrapMode:
-		return nixy.bubblewrapShell(ctx, command, args...)
-	default:
-		return nil, fmt.Errorf("unknown executor: %s, only local and docker executors are supported", ctx.NixyMode)
+	return nixy.prepareCommand(ctx, term.IsTerminal(int(os.Stdin.Fd())), command, args...)
+}
 
+// prepareCommand is PrepareShellCommand, where tty tells whether to allocate a tty (in sandboxed executors),
+// which must not be, when stdout is read by nixy itself
+func (nixy *NixyWrapper) prepareCommand(ctx *Context, tty bool, command string, args ...string) (*exec.Cmd, error) {
+	isWorktreeEnabled, workspaceDir, _ := GitWorktreeEnabledWorkspace(ctx, ctx.PWD)
+	if isWorktreeEnabled {
+		nixy.executorArgs.EnvVars.NixyWorkspaceLabel = filepath.Base(workspaceDir) + ctx.PWD[len(workspaceDir):]
 	}
+
+	mounts, err := nixy.executor.Mounts(ctx, nixy, workspaceDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return nixy.executor.Command(ctx, &ExecutorCommand{
+		Command:      command,
+		Args:         args,
+		Env:          nixy.executorArgs.EnvVars.toMap(ctx),
+		Mounts:       mounts,
+		WorkspaceDir: workspaceDir,
+		TTY:          tty,
+	})
+}
+
+// sandboxMounts plans mounts of sandboxed executors (i.e. all, but local), with the static nix binary at /nixy/nix.
+// INFO: the static nix binary is downloaded here, if missing, as it is mounted into the sandbox
+func (nixy *NixyWrapper) sandboxMounts(ctx *Context, workspaceDir string) ([]ExecutorMountPath, error) {
+	if !exists(nixy.runtimePaths.StaticNixBinPath) {
+		if err := downloadStaticNixBinary(ctx, nixy.runtimePaths.StaticNixBinPath); err != nil {
+			return nil, &ExitError{Code: ExitCodeNixNotFound, Err: err}
+		}
+	}
+
+	mounts := []ExecutorMountPath{
+		// STEP: nixy and nix binary mounts
+		{HostPath: ctx.NixyBinPath, MountPath: "/nixy/nixy", ReadOnly: true, Label: SELinuxLabelShared},
+		{HostPath: nixy.runtimePaths.StaticNixBinPath, MountPath: "/nixy/nix", ReadOnly: true, Label: SELinuxLabelShared},
+
+		// STEP: profile flake dir
+		{HostPath: nixy.runtimePaths.BasePath, MountPath: nixy.executorArgs.ProfileDirMountedPath, ReadOnly: true, Label: SELinuxLabelShared},
+
+		// Custom User Home for nixy shell
+		{HostPath: nixy.runtimePaths.FakeHomeDir, MountPath: nixy.executorArgs.FakeHomeMountedPath, Label: SELinuxLabelShared},
+
+		// Mount current flake directory
+		{HostPath: nixy.executorArgs.WorkspaceFlakeDirHostPath, MountPath: nixy.executorArgs.WorkspaceFlakeDirMountedPath, Label: SELinuxLabelShared},
+
+		// STEP: Nix Store
+		{HostPath: nixy.runtimePaths.NixDir, MountPath: nixy.executorArgs.NixDirMountedPath, Label: SELinuxLabelShared},
+
+		// STEP: project dir as it is, and at /workspace too
+		{HostPath: workspaceDir, MountPath: workspaceDir, Label: SELinuxLabelShared},
+		{HostPath: workspaceDir, MountPath: WorkspaceDirSandboxMountPath, Label: SELinuxLabelShared},
+	}
+
+	// Mount terminfo if TERMINFO env var is set
+	if terminfo := os.Getenv("TERMINFO"); terminfo != "" {
+		mounts = append(mounts, ExecutorMountPath{HostPath: terminfo, MountPath: nixy.executorArgs.EnvVars.TermInfo, ReadOnly: true, Label: SELinuxLabelShared})
+	}
+
+	userMounts := nixy.Mounts
+	if ctx.NixyUseProfile {
+		userMounts = append(userMounts, nixy.profileNixy.Mounts...)
+	}
+
+	executorEnv := nixy.executorArgs.EnvVars.toMap(ctx)
+	nixyEnv := nixy.envForPlatform(getOSArch())
+
+	for _, mount := range userMounts {
+		src := os.ExpandEnv(mount.Source)
+		dst := os.Expand(mount.Destination, func(s string) string {
+			if v, ok := executorEnv[s]; ok {
+				return v
+			}
+
+			if v, ok := nixyEnv[s]; ok {
+				return v
+			}
+
+			if nixy.profileNixy != nil {
+				if v, ok := nixy.profileNixy.envForPlatform(getOSArch())[s]; ok {
+					return v
+				}
+			}
+
+			// Return original $VAR syntax if not found, so errors are visible
+			return "$" + s
+		})
+
+		if src == "" || dst == "" {
+			return nil, fmt.Errorf("mount has empty source or destination: source=%q, dest=%q (original: %q -> %q)", src, dst, mount.Source, mount.Destination)
+		}
+
+		// INFO: user mounts are never relabeled, as relabeling (e.g. $HOME) would rewrite their SELinux labels on the host
+		mounts = append(mounts, ExecutorMountPath{HostPath: src, MountPath: dst, ReadOnly: mount.ReadOnly, Label: SELinuxLabelNone})
+	}
+
+	return mounts, nil
 }
 
 type executorEnvVars struct {
@@ -124,6 +282,10 @@ func (e *executorEnvVars) toMap(ctx *Context) map[string]string {
 		m["NIX_CONF_DIR"] = e.NixConfDir
 	}
 
+	if ctx.NixyFile != "" {
+		m["NIXY_FILE"] = ctx.NixyFile
+	}
+
 	maps.Copy(m, osArchEnv)
 	return m
 }
@@ -139,8 +301,21 @@ func (e *executorEnvVars) ToEnviron(ctx *Context) []string {
 	return result
 }
 
+// SELinuxLabel tells how container executors relabel a mount, for the container to access it on SELinux hosts
+type SELinuxLabel string
+
+const (
+	// SELinuxLabelNone keeps the host labels as is, e.g. for user defined mounts (like $HOME, or /etc)
+	SELinuxLabelNone SELinuxLabel = ""
+
+	// SELinuxLabelShared (z) is for nixy owned dirs and workspace dirs, shared among containers.
+	// INFO: never Z (private), as it locks out every other nixy shell running in the same workspace
+	SELinuxLabelShared SELinuxLabel = "z"
+)
+
 type ExecutorMountPath struct {
-	HostPath  string
-	MountPath string
-	ReadOnly  bool
+	HostPath  string       `json:"hostPath"`
+	MountPath string       `json:"mountPath"`
+	ReadOnly  bool         `json:"readOnly"`
+	Label     SELinuxLabel `json:"label,omitempty"`
 }
@@ -0,0 +1,166 @@
+package nixy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLookupExecutor(t *testing.T) {
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "nixy-executor-gvisor"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	tests := []struct {
+		name         string
+		mode         Mode
+		wantExternal bool
+		wantErr      bool
+	}{
+		{name: "registered executor", mode: DockerMode},
+		{name: "local-ignore-env is registered too", mode: LocalIgnoreEnvMode},
+		{name: "external executor on PATH", mode: "gvisor", wantExternal: true},
+		{name: "unknown executor", mode: "firecracker", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := lookupExecutor(tt.mode)
+			if tt.wantErr {
+				var exitErr *ExitError
+				if !errors.As(err, &exitErr) || exitErr.Code != ExitCodeConfig {
+					t.Fatalf("lookupExecutor() error = %v, want an ExitError with code %d", err, ExitCodeConfig)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("lookupExecutor() error = %v", err)
+			}
+
+			if _, ok := e.(*externalExecutor); ok != tt.wantExternal {
+				t.Errorf("lookupExecutor() = %T, want external: %v", e, tt.wantExternal)
+			}
+		})
+	}
+}
+
+func TestExternalExecutor_Command(t *testing.T) {
+	dir := t.TempDir()
+	reqFile := filepath.Join(dir, "request.json")
+
+	// INFO: a fake executor, that records the request, and runs the command in a "sandbox" named by SANDBOX
+	bin := filepath.Join(dir, "nixy-executor-fake")
+	script := "#!/bin/sh\n[ \"$1\" = prepare ] || exit 2\ncat > " + reqFile + "\n" +
+		`echo '{"argv": ["fake-sandbox", "--", "/nixy/nix", "shell"], "env": ["SANDBOX=fake"]}'` + "\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &externalExecutor{name: "fake", binPath: bin}
+	ctx := &Context{Context: context.TODO()}
+
+	cmd, err := e.Command(ctx, &ExecutorCommand{
+		Command: "/nixy/nix",
+		Args:    []string{"shell"},
+		Env:     map[string]string{"NIXY_SHELL": "true"},
+		Mounts:  []ExecutorMountPath{{HostPath: "/home/user/project", MountPath: "/workspace"}},
+	})
+	if err != nil {
+		t.Fatalf("Command() error = %v", err)
+	}
+
+	if want := []string{"fake-sandbox", "--", "/nixy/nix", "shell"}; !slices.Equal(cmd.Args, want) {
+		t.Errorf("Command() args = %q, want %q", cmd.Args, want)
+	}
+
+	if !slices.Contains(cmd.Env, "SANDBOX=fake") {
+		t.Errorf("Command() env must have the response's env, got %q", cmd.Env)
+	}
+
+	req, err := os.ReadFile(reqFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{`"version":1`, `"executor":"fake"`, `"mountPath":"/workspace"`, `"NIXY_SHELL":"true"`} {
+		if !strings.Contains(string(req), want) {
+			t.Errorf("request %s must contain %s", req, want)
+		}
+	}
+}
+
+func TestParseExternalExecutorResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		resp    string
+		wantErr bool
+	}{
+		{name: "argv only", resp: `{"argv": ["runsc", "do", "/nixy/nix"]}`},
+		{name: "empty argv", resp: `{"argv": []}`, wantErr: true},
+		{name: "not json", resp: `runsc do /nixy/nix`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseExternalExecutorResponse([]byte(tt.resp))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseExternalExecutorResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestContainerVolume(t *testing.T) {
+	tests := []struct {
+		name  string
+		mount ExecutorMountPath
+		want  string
+	}{
+		{
+			name:  "nixy owned dir is shared",
+			mount: ExecutorMountPath{HostPath: "/data/nixy/nix", MountPath: "/nix", Label: SELinuxLabelShared},
+			want:  "/data/nixy/nix:/nix:z",
+		},
+		{
+			name:  "read only workspace dir is shared",
+			mount: ExecutorMountPath{HostPath: "/home/user/project", MountPath: "/workspace", ReadOnly: true, Label: SELinuxLabelShared},
+			want:  "/home/user/project:/workspace:ro,z",
+		},
+		{
+			name:  "user mount is never relabeled",
+			mount: ExecutorMountPath{HostPath: "/home/user", MountPath: "/home/user"},
+			want:  "/home/user:/home/user",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := containerVolume(tt.mount); got != tt.want {
+				t.Errorf("containerVolume() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalExecutor_Environ(t *testing.T) {
+	ctx := &Context{Context: context.TODO(), NixyMode: LocalMode, PWD: "/home/user/project", NixyFile: "/home/user/project/nixy.ci.yml"}
+	args := &ExecutorArgs{EnvVars: executorEnvVars{NixyWorkspaceDir: "/home/user/project", XDGCacheHome: "/fake-home/.cache"}}
+
+	environ := (&localExecutor{}).Environ(ctx, args)
+	for _, want := range []string{"NIXY_SHELL=true", "NIXY_WORKSPACE_DIR=/home/user/project", "NIXY_FILE=/home/user/project/nixy.ci.yml"} {
+		if !slices.Contains(environ, want) {
+			t.Errorf("Environ() must have %s", want)
+		}
+	}
+
+	// INFO: host env is kept as is, with the local executor
+	if slices.Contains(environ, "XDG_CACHE_HOME=/fake-home/.cache") {
+		t.Errorf("Environ() must not override host env, got %q", environ)
+	}
+}
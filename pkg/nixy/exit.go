@@ -0,0 +1,110 @@
+package nixy
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// Exit codes for nixy's own failures. When nixy runs a process (e.g. nixy shell <cmd>, nixy exec, nixy run),
+// that process' exit code is nixy's exit code, and a process killed by a signal exits with 128+<signal>
+const (
+	ExitCodeGeneric = 1
+
+	// ExitCodeConfig is for an invalid nixy file (EX_DATAERR)
+	ExitCodeConfig = 65
+
+	// ExitCodeNixNotFound is when nix could not be found, or downloaded (EX_UNAVAILABLE)
+	ExitCodeNixNotFound = 69
+
+	// ExitCodeFlakeEval is when the workspace flake could not be evaluated, i.e. `nix print-dev-env` failed (EX_SOFTWARE)
+	ExitCodeFlakeEval = 70
+)
+
+// ExitError is a nixy failure, with the exit code nixy must exit with
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// ProcessExitError is the exit status of the user's own command (e.g. nixy shell <cmd>, nixy exec, nixy run),
+// which has already reported its failure
+type ProcessExitError struct {
+	Err *exec.ExitError
+}
+
+func (e *ProcessExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ProcessExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode is the command's exit code, or 128+<signal> if it was killed by a signal
+func (e *ProcessExitError) ExitCode() int {
+	if ws, ok := e.Err.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return e.Err.ExitCode()
+}
+
+// runProcess runs the user's command, and wraps its exit status as ProcessExitError
+func runProcess(cmd *exec.Cmd) error {
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return &ProcessExitError{Err: exitErr}
+	}
+
+	return err
+}
+
+// ExitCode returns the exit code for err, to be used as nixy's exit code
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var procErr *ProcessExitError
+	if errors.As(err, &procErr) {
+		return procErr.ExitCode()
+	}
+
+	var nixyErr *ExitError
+	if errors.As(err, &nixyErr) {
+		return nixyErr.Code
+	}
+
+	// INFO: any other process (e.g. nix, git) failing, is nixy's own failure
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return ExitCodeGeneric
+	}
+
+	var exitCoder interface{ ExitCode() int }
+	if errors.As(err, &exitCoder) {
+		return exitCoder.ExitCode()
+	}
+
+	return ExitCodeGeneric
+}
+
+// IsProcessExit tells if err is just the exit status of the user's own command, which has already reported its failure
+func IsProcessExit(err error) bool {
+	var procErr *ProcessExitError
+	return errors.As(err, &procErr)
+}
@@ -0,0 +1,71 @@
+package nixy
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  func() error
+		want int
+	}{
+		{
+			name: "no error",
+			err:  func() error { return nil },
+			want: 0,
+		},
+		{
+			name: "user's command exit status is passed through",
+			err:  func() error { return runProcess(exec.Command("sh", "-c", "exit 3")) },
+			want: 3,
+		},
+		{
+			name: "user's command killed by a signal",
+			err:  func() error { return runProcess(exec.Command("sh", "-c", "kill -TERM $$")) },
+			want: 128 + 15,
+		},
+		{
+			name: "any other process failing is nixy's failure",
+			err:  func() error { return fmt.Errorf("nix failed: %w", exec.Command("sh", "-c", "exit 3").Run()) },
+			want: ExitCodeGeneric,
+		},
+		{
+			name: "wrapped nixy failure",
+			err: func() error {
+				return fmt.Errorf("failed to load: %w", &ExitError{Code: ExitCodeConfig, Err: errors.New("bad nixy.yml")})
+			},
+			want: ExitCodeConfig,
+		},
+		{
+			name: "any other error",
+			err:  func() error { return errors.New("oops") },
+			want: ExitCodeGeneric,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err()); got != tt.want {
+				t.Errorf("expected exit code %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestIsProcessExit(t *testing.T) {
+	if err := runProcess(exec.Command("sh", "-c", "exit 3")); !IsProcessExit(err) {
+		t.Errorf("user's command exit must be a process exit, got: %v", err)
+	}
+
+	if err := exec.Command("sh", "-c", "exit 3").Run(); IsProcessExit(err) {
+		t.Errorf("any other process failing must not be a process exit, so that nixy logs it, got: %v", err)
+	}
+
+	if err := runProcess(exec.Command("/nonexistent/cmd")); err == nil || IsProcessExit(err) {
+		t.Errorf("failing to start the command must not be a process exit, got: %v", err)
+	}
+}
@@ -0,0 +1,275 @@
+package nixy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// HookShells are the shells, that `nixy hook-env` could emit statements for
+var HookShells = []string{"bash", "zsh", "fish"}
+
+// hookStateEnvVar holds the state of in place activation, in the parent shell
+const hookStateEnvVar = "NIXY_HOOK_STATE"
+
+// hookState is what `nixy hook-env` activated in the parent shell
+type hookState struct {
+	File string `json:"file"`
+	Hash string `json:"hash"`
+
+	// Prev holds the values, env vars had before activation (nil if they were unset)
+	Prev map[string]*string `json:"prev"`
+
+	// NotAllowed is the nixy file, which has been warned about not being allowed, so that it is warned about only once
+	NotAllowed string `json:"notAllowed,omitempty"`
+}
+
+func (s *hookState) encode() (string, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeHookState(s string) (*hookState, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", hookStateEnvVar, err)
+	}
+
+	var state hookState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", hookStateEnvVar, err)
+	}
+
+	return &state, nil
+}
+
+// hookEnvCache is the workspace env diff, cached for a nixy.yml hash
+type hookEnvCache struct {
+	Hash string            `json:"hash"`
+	Env  map[string]string `json:"env"`
+}
+
+// HookEnv returns statements for shell, which bring the parent shell in sync with the nixy file (if any) found from the current directory.
+// Entering a workspace exports its env, and leaving it restores the env vars, as they were before.
+// file is empty, when there is no nixy file.
+func HookEnv(parent context.Context, shell string, file string) (string, error) {
+	if !slices.Contains(HookShells, shell) {
+		return "", fmt.Errorf("unsupported shell: %s (supported: %s)", shell, strings.Join(HookShells, ", "))
+	}
+
+	if mode := os.Getenv("NIXY_EXECUTOR"); mode != "" && Mode(mode) != LocalMode {
+		return "", fmt.Errorf("nixy hook-env works only with local executor, but NIXY_EXECUTOR is %q. Use NIXY_HOOK_MODE=shell for a nested nixy shell instead", mode)
+	}
+
+	// INFO: hook-env runs on every prompt, so it must never fetch URL package hashes, nor write them back to nixy.yml
+	parent = withReadOnlyNixyFile(parent)
+
+	state, err := decodeHookState(os.Getenv(hookStateEnvVar))
+	if err != nil {
+		slog.Warn("discarding invalid state", "err", err)
+	}
+
+	if file == "" {
+		if state == nil {
+			return "", nil
+		}
+		runShellExit(state)
+		return hookStatements(shell, nil, state.Prev, nil)
+	}
+
+	status, err := CheckAllowed(file)
+	if err != nil {
+		return "", err
+	}
+
+	if status != AllowStatusAllowed {
+		if state != nil && state.NotAllowed == file && state.File == "" {
+			return "", nil
+		}
+
+		slog.Warn((&NotAllowedError{File: file, Status: status}).Error())
+
+		var prev map[string]*string
+		if state != nil {
+			runShellExit(state)
+			prev = state.Prev
+		}
+		return hookStatements(shell, nil, prev, &hookState{NotAllowed: file})
+	}
+
+	nc, err := parseAndSyncNixyFile(parent, file)
+	if err != nil {
+		return "", &ExitError{Code: ExitCodeConfig, Err: err}
+	}
+
+	if state != nil && state.File == file && state.Hash == nc.sha256Sum {
+		return "", nil
+	}
+
+	// INFO: previous activation is reverted first, so that the workspace env is evaluated against the shell's own env
+	if state != nil {
+		if state.File != file {
+			runShellExit(state)
+		}
+
+		for k, v := range state.Prev {
+			if v == nil {
+				os.Unsetenv(k)
+				continue
+			}
+			os.Setenv(k, *v)
+		}
+	}
+
+	// INFO: workspace flake dir is keyed by the current directory, so it must be the same from anywhere in the workspace
+	if err := os.Chdir(filepath.Dir(file)); err != nil {
+		return "", err
+	}
+
+	env, err := cachedWorkspaceEnv(parent, file, nc.sha256Sum)
+	if err != nil {
+		return "", err
+	}
+
+	next := &hookState{File: file, Hash: nc.sha256Sum, Prev: make(map[string]*string, len(env))}
+	for k := range env {
+		if v, ok := os.LookupEnv(k); ok {
+			next.Prev[k] = &v
+			continue
+		}
+		next.Prev[k] = nil
+	}
+
+	var prev map[string]*string
+	if state != nil {
+		prev = state.Prev
+	}
+
+	return hookStatements(shell, env, prev, next)
+}
+
+// runShellExit runs onShellExit of the workspace in state, as it is unloaded (in env mode, there is no nixy shell exiting).
+// It must run before the workspace env is reverted, so that it runs with the same env as onShellEnter
+func runShellExit(state *hookState) {
+	if state.File == "" {
+		return
+	}
+
+	dir := filepath.Dir(state.File)
+	hookFile := filepath.Join(workspaceFlakeDirPath(CurrentProfileName(), dir), shellExitFileName)
+	if fi, err := os.Stat(hookFile); err != nil || fi.Size() == 0 {
+		return
+	}
+
+	cmd := exec.Command("bash", hookFile)
+	cmd.Dir = dir
+	// INFO: stdout of hook-env is evaluated by the shell, so onShellExit must print to stderr
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		slog.Warn("onShellExit failed", "file", state.File, "err", err)
+	}
+}
+
+// cachedWorkspaceEnv returns the workspace env diff, evaluating the workspace only when nixy.yml has changed
+func cachedWorkspaceEnv(ctx context.Context, file string, hash string) (map[string]string, error) {
+	cacheFile := filepath.Join(flakeDirPath(CurrentProfileName()), "hook-env.json")
+
+	if b, err := os.ReadFile(cacheFile); err == nil {
+		var cache hookEnvCache
+		if err := json.Unmarshal(b, &cache); err == nil && cache.Hash == hash {
+			if err := saveWorkspaceMetadata(filepath.Dir(cacheFile), filepath.Dir(file), LocalMode); err != nil {
+				slog.Warn("failed to save workspace metadata", "err", err)
+			}
+			return cache.Env, nil
+		}
+	}
+
+	n, err := LoadFromFile(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := n.WorkspaceEnv(n.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(hookEnvCache{Hash: hash, Env: env})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(cacheFile, b, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to cache workspace env: %w", err)
+	}
+
+	return env, nil
+}
+
+// hookStatements renders statements, that restore env vars from prev (which are not part of env),
+// export env, and save next as the state (or clear it, if next is nil)
+func hookStatements(shell string, env map[string]string, prev map[string]*string, next *hookState) (string, error) {
+	b := new(strings.Builder)
+
+	export := func(k, v string) {
+		if shell == "fish" {
+			fmt.Fprintf(b, "set -gx %s %s;\n", k, fishQuote(v))
+			return
+		}
+		fmt.Fprintf(b, "export %s=%s;\n", k, shellQuote(v))
+	}
+
+	unset := func(k string) {
+		if shell == "fish" {
+			fmt.Fprintf(b, "set -e %s;\n", k)
+			return
+		}
+		fmt.Fprintf(b, "unset %s;\n", k)
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(prev)) {
+		if _, ok := env[k]; ok {
+			continue
+		}
+
+		if prev[k] == nil {
+			unset(k)
+			continue
+		}
+		export(k, *prev[k])
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		export(k, env[k])
+	}
+
+	if next == nil {
+		unset(hookStateEnvVar)
+		return b.String(), nil
+	}
+
+	s, err := next.encode()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode %s: %w", hookStateEnvVar, err)
+	}
+	export(hookStateEnvVar, s)
+
+	return b.String(), nil
+}
@@ -0,0 +1,189 @@
+package nixy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHookStatements(t *testing.T) {
+	home := "/home/user"
+	path := "/usr/bin"
+
+	tests := []struct {
+		name  string
+		shell string
+		env   map[string]string
+		prev  map[string]*string
+		next  *hookState
+		want  string
+	}{
+		{
+			name:  "entering a workspace",
+			shell: "bash",
+			env:   map[string]string{"PATH": "/nix/store/abc/bin:/usr/bin", "GREETING": "it's nixy"},
+			next:  &hookState{File: "/ws/nixy.yml", Hash: "abc1234", Prev: map[string]*string{"PATH": &path, "GREETING": nil}},
+			want: `export GREETING='it'\''s nixy';
+export PATH='/nix/store/abc/bin:/usr/bin';
+export NIXY_HOOK_STATE=`,
+		},
+		{
+			name:  "leaving a workspace",
+			shell: "zsh",
+			prev:  map[string]*string{"PATH": &path, "GREETING": nil},
+			want: `unset GREETING;
+export PATH='/usr/bin';
+unset NIXY_HOOK_STATE;
+`,
+		},
+		{
+			name:  "switching workspaces, with fish",
+			shell: "fish",
+			env:   map[string]string{"HOME": "/ws/.home"},
+			prev:  map[string]*string{"HOME": &home, "GREETING": nil},
+			next:  &hookState{File: "/other/nixy.yml", Hash: "def5678", Prev: map[string]*string{"HOME": &home}},
+			want: `set -e GREETING;
+set -gx HOME '/ws/.home';
+set -gx NIXY_HOOK_STATE `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := hookStatements(tt.shell, tt.env, tt.prev, tt.next)
+			if err != nil {
+				t.Fatalf("hookStatements() error = %v", err)
+			}
+
+			if !strings.HasPrefix(got, tt.want) {
+				t.Errorf("hookStatements()\ngot:\n%s\nwant prefix:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHookState_RoundTrip(t *testing.T) {
+	path := "/usr/bin"
+	state := &hookState{File: "/ws/nixy.yml", Hash: "abc1234", Prev: map[string]*string{"PATH": &path, "GREETING": nil}}
+
+	s, err := state.encode()
+	if err != nil {
+		t.Fatalf("encode() error = %v", err)
+	}
+
+	if strings.ContainsAny(s, " '\"$\n") {
+		t.Errorf("encoded state %q must be safe to use unquoted", s)
+	}
+
+	got, err := decodeHookState(s)
+	if err != nil {
+		t.Fatalf("decodeHookState() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, state) {
+		t.Errorf("decodeHookState() = %+v, want %+v", got, state)
+	}
+
+	if _, err := decodeHookState("not-a-state!"); err == nil {
+		t.Errorf("decodeHookState() must fail on invalid state")
+	}
+}
+
+func TestHookEnv_WarnsOnceAboutNotAllowedFile(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("NIXY_EXECUTOR", "")
+	t.Setenv(hookStateEnvVar, "")
+
+	file := filepath.Join(t.TempDir(), "nixy.yml")
+	if err := os.WriteFile(file, []byte("onShellEnter: echo hi\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := HookEnv(context.TODO(), "bash", file)
+	if err != nil {
+		t.Fatalf("HookEnv() error = %v", err)
+	}
+	if !strings.HasPrefix(got, "export NIXY_HOOK_STATE=") {
+		t.Fatalf("HookEnv() must record the warned file in its state, got: %q", got)
+	}
+
+	state, err := (&hookState{NotAllowed: file}).encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(hookStateEnvVar, state)
+
+	got, err = HookEnv(context.TODO(), "bash", file)
+	if err != nil {
+		t.Fatalf("HookEnv() error = %v", err)
+	}
+	if got != "" {
+		t.Errorf("HookEnv() must not warn about the same file again, got: %q", got)
+	}
+}
+
+func TestLoadNixyFile_ReadOnly(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "nixy.yml")
+	content := []byte(`nixpkgs:
+  default: abc123
+packages:
+  - name: run
+    sources:
+      ` + getOSArch() + `:
+        url: http://127.0.0.1:1/run
+`)
+	if err := os.WriteFile(file, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := loadNixyFile(withReadOnlyNixyFile(context.TODO()), file, nil)
+	if err == nil || !strings.Contains(err.Error(), "nixy lock") {
+		t.Errorf("loadNixyFile() must ask to run nixy lock, instead of fetching, got err = %v", err)
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != string(content) {
+		t.Errorf("loadNixyFile() must not rewrite %s, got:\n%s", file, b)
+	}
+}
+
+func TestHookEnv_RunsShellExitOnUnload(t *testing.T) {
+	oldBase := profileBasePath
+	profileBasePath = t.TempDir()
+	t.Cleanup(func() { profileBasePath = oldBase })
+	t.Setenv("NIXY_EXECUTOR", "")
+
+	dir := t.TempDir()
+	flakeDir := workspaceFlakeDirPath(CurrentProfileName(), dir)
+	if err := os.MkdirAll(flakeDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(flakeDir, shellExitFileName), []byte("echo bye > exited\n"), 0o744); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := (&hookState{File: filepath.Join(dir, "nixy.yml"), Hash: "abc1234"}).encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(hookStateEnvVar, state)
+
+	got, err := HookEnv(context.TODO(), "bash", "")
+	if err != nil {
+		t.Fatalf("HookEnv() error = %v", err)
+	}
+	if got != "unset NIXY_HOOK_STATE;\n" {
+		t.Errorf("HookEnv() = %q, must only clear the state", got)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "exited"))
+	if err != nil || string(b) != "bye\n" {
+		t.Errorf("onShellExit must run in the workspace dir, as it is unloaded: %q, %v", b, err)
+	}
+}
@@ -0,0 +1,202 @@
+package nixy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/nxtcoder17/nixy/pkg/set"
+)
+
+const profileImportPrefix = "profile:"
+
+// resolveImportPath resolves an import, relative to the nixy file importing it
+func resolveImportPath(importingFile string, imp string) string {
+	imp = os.ExpandEnv(imp)
+
+	if p, ok := strings.CutPrefix(imp, profileImportPrefix); ok {
+		return filepath.Join(profilePath(CurrentProfileName()), p)
+	}
+
+	if filepath.IsAbs(imp) {
+		return imp
+	}
+
+	return filepath.Join(filepath.Dir(importingFile), imp)
+}
+
+// loadNixyFileWithImports loads the nixy file, along with all its imports (recursively).
+// Imports are merged in order, and the nixy file itself is merged last, so that it wins over its imports.
+// Every loaded file's content is written to the hasher. visited tracks files loaded in the whole traversal,
+// so that a file imported more than once (e.g. A imports B and C, both importing D) is merged only once
+func loadNixyFileWithImports(ctx context.Context, file string, lock *LockFile, hasher io.Writer, importedBy []string, visited *set.Set[string]) (*Nixy, error) {
+	if slices.Contains(importedBy, file) {
+		return nil, fmt.Errorf("import cycle detected: %s -> %s", strings.Join(importedBy, " -> "), file)
+	}
+
+	if visited.Has(file) {
+		return &Nixy{}, nil
+	}
+	visited.Add(file)
+
+	nc, b, err := loadNixyFile(ctx, file, lock)
+	if err != nil {
+		return nil, err
+	}
+	hasher.Write(b)
+
+	// INFO: overlays are resolved relative to the file declaring them, and their directories must also affect the hash
+	for i, overlay := range nc.Overlays {
+		if !filepath.IsAbs(overlay) {
+			nc.Overlays[i] = filepath.Join(filepath.Dir(file), overlay)
+		}
+
+		if err := hashOverlayDir(hasher, nc.Overlays[i]); err != nil {
+			return nil, fmt.Errorf("failed to read overlay (%s): %w", overlay, err)
+		}
+	}
+
+	if len(nc.Imports) == 0 {
+		return nc, nil
+	}
+
+	merged := &Nixy{}
+	for _, imp := range nc.Imports {
+		importFile := resolveImportPath(file, imp)
+		imported, err := loadNixyFileWithImports(ctx, importFile, lock, hasher, append(importedBy, file), visited)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import %q (from %s): %w", imp, file, err)
+		}
+		merged.merge(imported)
+	}
+
+	merged.merge(nc)
+
+	merged.Imports = nc.Imports
+	merged.rawNode = nc.rawNode
+
+	return merged, nil
+}
+
+// merge merges other into n, where other takes precedence.
+// packages and libraries are deduplicated, maps are overridden key by key, and rest of the lists are appended
+func (n *Nixy) merge(other *Nixy) {
+	if n.NixPkgs == nil {
+		n.NixPkgs = NixPkgsMap{}
+	}
+	maps.Copy(n.NixPkgs, other.NixPkgs)
+
+	n.Packages = dedupeLast(append(n.Packages, other.Packages...), importPackageKey)
+
+	n.Libraries = dedupeLast(append(n.Libraries, other.Libraries...), importPackageKey)
+
+	if len(other.Env) > 0 {
+		if n.Env == nil {
+			n.Env = make(map[string]string, len(other.Env))
+		}
+		maps.Copy(n.Env, other.Env)
+	}
+
+	for pattern, env := range other.PlatformEnv {
+		if n.PlatformEnv == nil {
+			n.PlatformEnv = make(map[string]map[string]string, len(other.PlatformEnv))
+		}
+		if n.PlatformEnv[pattern] == nil {
+			n.PlatformEnv[pattern] = make(map[string]string, len(env))
+		}
+		maps.Copy(n.PlatformEnv[pattern], env)
+	}
+
+	if len(other.Scripts) > 0 {
+		if n.Scripts == nil {
+			n.Scripts = make(map[string]Script, len(other.Scripts))
+		}
+		maps.Copy(n.Scripts, other.Scripts)
+	}
+
+	if len(other.Shells) > 0 {
+		if n.Shells == nil {
+			n.Shells = make(map[string]ShellVariant, len(other.Shells))
+		}
+		maps.Copy(n.Shells, other.Shells)
+	}
+
+	if len(other.Builds) > 0 {
+		if n.Builds == nil {
+			n.Builds = make(map[string]Build, len(other.Builds))
+		}
+		maps.Copy(n.Builds, other.Builds)
+	}
+
+	n.Mounts = append(n.Mounts, other.Mounts...)
+	n.Overlays = append(n.Overlays, other.Overlays...)
+
+	if len(other.NixpkgsConfig) > 0 {
+		if n.NixpkgsConfig == nil {
+			n.NixpkgsConfig = make(map[string]any, len(other.NixpkgsConfig))
+		}
+		maps.Copy(n.NixpkgsConfig, other.NixpkgsConfig)
+	}
+
+	switch {
+	case strings.TrimSpace(other.ExtraPackagesExpr) == "":
+	case strings.TrimSpace(n.ExtraPackagesExpr) == "":
+		n.ExtraPackagesExpr = other.ExtraPackagesExpr
+	default:
+		n.ExtraPackagesExpr = fmt.Sprintf("(%s) ++ (%s)", n.ExtraPackagesExpr, other.ExtraPackagesExpr)
+	}
+
+	n.OnShellEnter = joinScripts(n.OnShellEnter, other.OnShellEnter)
+	n.OnShellExit = joinScripts(n.OnShellExit, other.OnShellExit)
+}
+
+// importPackageKey is the identity of a package across imports,
+// nix packages from different nixpkgs (e.g. `go` and `unstable#go`) are not duplicates
+func importPackageKey(pkg *NormalizedPackage) string {
+	if pkg == nil {
+		return ""
+	}
+
+	if pkg.NixPackage != nil {
+		commit := pkg.NixPackage.Commit
+		if commit == "" {
+			commit = "default"
+		}
+		return commit + "#" + pkg.NixPackage.Name
+	}
+
+	return packageKey(pkg)
+}
+
+// dedupeLast removes items with duplicate keys, keeping position of the first one, and the value of the last one
+func dedupeLast[T any](items []T, key func(T) string) []T {
+	var seen set.Set[string]
+	result := make([]T, 0, len(items))
+	for _, item := range items {
+		k := key(item)
+		if seen.Has(k) {
+			i := slices.IndexFunc(result, func(v T) bool { return key(v) == k })
+			result[i] = item
+			continue
+		}
+		seen.Add(k)
+		result = append(result, item)
+	}
+	return result
+}
+
+func joinScripts(a, b string) string {
+	switch {
+	case strings.TrimSpace(a) == "":
+		return b
+	case strings.TrimSpace(b) == "":
+		return a
+	default:
+		return strings.TrimRight(a, "\n") + "\n" + b
+	}
+}
@@ -0,0 +1,133 @@
+package nixy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeImportTestFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestImports(t *testing.T) {
+	dir := writeImportTestFiles(t, map[string]string{
+		"shared/base.yml": `nixpkgs:
+  default: abc123
+  unstable: def456
+packages:
+  - go
+  - jq
+env:
+  GOFLAGS: -mod=mod
+  EDITOR: vim
+onShellEnter: echo base
+mounts:
+  - source: /run
+    dest: /run
+`,
+		"service/nixy.yml": `imports:
+  - ../shared/base.yml
+packages:
+  - unstable#go
+  - default#jq
+  - ripgrep
+env:
+  EDITOR: nvim
+onShellEnter: echo service
+`,
+	})
+
+	nc, err := parseAndSyncNixyFile(context.TODO(), filepath.Join(dir, "service", "nixy.yml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pkgs := make([]string, 0, len(nc.Packages))
+	for _, pkg := range nc.Packages {
+		pkgs = append(pkgs, pkg.NixPackage.Commit+"#"+pkg.NixPackage.Name)
+	}
+	// INFO: `unstable#go` is not a duplicate of `go`, while `default#jq` is of `jq`
+	if want := []string{"#go", "default#jq", "unstable#go", "#ripgrep"}; !slices.Equal(pkgs, want) {
+		t.Errorf("packages mismatch:\ngot:  %q\nwant: %q", pkgs, want)
+	}
+
+	if nc.NixPkgs["unstable"] != "def456" {
+		t.Errorf("expected nixpkgs from imported file, got %v", nc.NixPkgs)
+	}
+
+	if nc.Env["EDITOR"] != "nvim" || nc.Env["GOFLAGS"] != "-mod=mod" {
+		t.Errorf("env mismatch, got %v", nc.Env)
+	}
+
+	if nc.OnShellEnter != "echo base\necho service" {
+		t.Errorf("onShellEnter mismatch, got %q", nc.OnShellEnter)
+	}
+
+	if len(nc.Mounts) != 1 {
+		t.Errorf("expected mounts from imported file, got %v", nc.Mounts)
+	}
+
+	// editing an imported file, must change the workspace hash
+	before := nc.sha256Sum
+	if err := os.WriteFile(filepath.Join(dir, "shared", "base.yml"), []byte("nixpkgs:\n  default: xyz789\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	nc, err = parseAndSyncNixyFile(context.TODO(), filepath.Join(dir, "service", "nixy.yml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if nc.sha256Sum == before {
+		t.Errorf("expected workspace hash to change, when an imported file changes")
+	}
+}
+
+func TestImportCycle(t *testing.T) {
+	dir := writeImportTestFiles(t, map[string]string{
+		"a.yml": "imports: [b.yml]\nnixpkgs:\n  default: abc123\n",
+		"b.yml": "imports: [a.yml]\n",
+	})
+
+	_, err := parseAndSyncNixyFile(context.TODO(), filepath.Join(dir, "a.yml"))
+	if err == nil || !strings.Contains(err.Error(), "import cycle detected") {
+		t.Fatalf("expected import cycle error, got %v", err)
+	}
+}
+
+func TestImportDiamond(t *testing.T) {
+	dir := writeImportTestFiles(t, map[string]string{
+		"a.yml": "imports: [b.yml, c.yml]\nnixpkgs:\n  default: abc123\n",
+		"b.yml": "imports: [d.yml]\n",
+		"c.yml": "imports: [d.yml]\n",
+		"d.yml": "onShellEnter: echo d\nonShellExit: echo bye\nmounts:\n  - source: /run\n    dest: /run\n",
+	})
+
+	nc, err := parseAndSyncNixyFile(context.TODO(), filepath.Join(dir, "a.yml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if nc.OnShellEnter != "echo d" || strings.TrimSpace(nc.OnShellExit) != "echo bye" {
+		t.Errorf("d.yml must be merged once, got onShellEnter %q, onShellExit %q", nc.OnShellEnter, nc.OnShellExit)
+	}
+
+	if len(nc.Mounts) != 1 {
+		t.Errorf("d.yml must be merged once, got mounts %+v", nc.Mounts)
+	}
+}
@@ -0,0 +1,211 @@
+package nixy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+const (
+	lockFileName    = "nixy.lock"
+	lockFileVersion = 1
+
+	flakeUtilsInput = "flake-utils"
+)
+
+// LockedInput is a flake input pinned to a revision, along with its narHash
+type LockedInput struct {
+	Rev     string `json:"rev"`
+	NarHash string `json:"narHash"`
+}
+
+// LockFile pins every input of a nixy workspace, so that every machine gets exactly the same inputs.
+// It lives next to nixy.yml, as nixy.lock
+type LockFile struct {
+	Version int `json:"version"`
+
+	// NixPkgs is keyed by nixpkgs key in nixy.yml
+	NixPkgs map[string]LockedInput `json:"nixpkgs"`
+
+	// FlakeInputs are the other inputs of workspace flake, like flake-utils
+	FlakeInputs map[string]LockedInput `json:"flakeInputs"`
+
+	// URLPackages is keyed by URL package name, and then by platform, having sha256 as value
+	URLPackages map[string]map[string]string `json:"urlPackages,omitempty"`
+}
+
+// LockFilePath is the path of nixy.lock, for the given nixy file
+func LockFilePath(nixyFile string) string {
+	return filepath.Join(filepath.Dir(nixyFile), lockFileName)
+}
+
+// ReadLockFile reads the lock file at path.
+// It returns an error satisfying errors.Is(err, fs.ErrNotExist), if the lock file does not exist
+func ReadLockFile(path string) (*LockFile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var lock LockFile
+	if err := json.Unmarshal(b, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse lock file (%s): %w", path, err)
+	}
+
+	if lock.Version != lockFileVersion {
+		return nil, fmt.Errorf("unsupported lock file (%s) version %d, expected %d", path, lock.Version, lockFileVersion)
+	}
+
+	return &lock, nil
+}
+
+// Save writes the lock file to the given path
+func (l *LockFile) Save(path string) error {
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// nixpkgsNarHash returns the locked narHash for a nixpkgs key, only if it is locked at the same commit
+func (l *LockFile) nixpkgsNarHash(key, commit string) string {
+	if l == nil {
+		return ""
+	}
+
+	locked, ok := l.NixPkgs[key]
+	if !ok {
+		return ""
+	}
+
+	if locked.Rev != commit {
+		slog.Warn("nixy.lock is out of date, run `nixy lock` to update it", "nixpkgs", key, "locked", locked.Rev, "nixy.yml", commit)
+		return ""
+	}
+
+	return locked.NarHash
+}
+
+// flakeInput returns the locked flake input, or the fallback revision when it is not locked
+func (l *LockFile) flakeInput(name, fallbackRev string) LockedInput {
+	if l == nil {
+		return LockedInput{Rev: fallbackRev}
+	}
+
+	if locked, ok := l.FlakeInputs[name]; ok && locked.Rev != "" {
+		return locked
+	}
+
+	return LockedInput{Rev: fallbackRev}
+}
+
+// urlPackageSHA256 returns the locked sha256 of a URL package for a platform
+func (l *LockFile) urlPackageSHA256(name, platform string) string {
+	if l == nil {
+		return ""
+	}
+
+	return l.URLPackages[name][platform]
+}
+
+// nixFlakePrefetchResult represents the JSON output from `nix flake prefetch`
+type nixFlakePrefetchResult struct {
+	Hash   string `json:"hash"`
+	Locked struct {
+		Rev     string `json:"rev"`
+		NarHash string `json:"narHash"`
+	} `json:"locked"`
+}
+
+// prefetchFlakeInput resolves a flake reference, into its locked revision and narHash
+func prefetchFlakeInput(ctx context.Context, flakeRef string) (*LockedInput, error) {
+	nixBin, err := findNixBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Prefetching", "flake", flakeRef)
+
+	cmd := exec.CommandContext(ctx, nixBin, "--extra-experimental-features", "nix-command flakes", "flake", "prefetch", "--json", flakeRef)
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to run nix flake prefetch (%s): %w", flakeRef, err)
+	}
+
+	var result nixFlakePrefetchResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse nix flake prefetch output: %w", err)
+	}
+
+	locked := LockedInput{Rev: result.Locked.Rev, NarHash: result.Locked.NarHash}
+	if locked.NarHash == "" {
+		locked.NarHash = result.Hash
+	}
+
+	return &locked, nil
+}
+
+// Lock resolves every input of the nixy file, and (re)generates the nixy.lock next to it
+func Lock(ctx context.Context, nixyFile string) (*LockFile, error) {
+	nc, err := parseAndSyncNixyFile(ctx, nixyFile)
+	if err != nil {
+		return nil, &ExitError{Code: ExitCodeConfig, Err: err}
+	}
+
+	lock := LockFile{
+		Version:     lockFileVersion,
+		NixPkgs:     make(map[string]LockedInput, len(nc.NixPkgs)),
+		FlakeInputs: map[string]LockedInput{},
+		URLPackages: map[string]map[string]string{},
+	}
+
+	for _, key := range nc.NixPkgs.List() {
+		locked, err := prefetchFlakeInput(ctx, "github:nixos/nixpkgs/"+nc.NixPkgs[key])
+		if err != nil {
+			return nil, err
+		}
+		lock.NixPkgs[key] = *locked
+	}
+
+	locked, err := prefetchFlakeInput(ctx, "github:numtide/flake-utils/"+flakeUtilsRev)
+	if err != nil {
+		return nil, err
+	}
+	lock.FlakeInputs[flakeUtilsInput] = *locked
+
+	for _, pkg := range nc.Packages {
+		if pkg == nil || pkg.URLPackage == nil {
+			continue
+		}
+
+		hashes := make(map[string]string, len(pkg.URLPackage.Sources))
+		for platform, source := range pkg.URLPackage.Sources {
+			hash := source.SHA256
+			if hash == "" {
+				hash, err = fetchURLPackageHash(ctx, source.URL)
+				if err != nil {
+					return nil, fmt.Errorf("failed to fetch SHA256 hash for (name: %s, url: %s): %w", pkg.URLPackage.Name, source.URL, err)
+				}
+			}
+			hashes[platform] = hash
+		}
+		lock.URLPackages[pkg.URLPackage.Name] = hashes
+	}
+
+	if err := lock.Save(LockFilePath(nixyFile)); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", lockFileName, err)
+	}
+
+	return &lock, nil
+}
@@ -0,0 +1,87 @@
+package nixy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/nxtcoder17/nixy/pkg/nixy/templates"
+)
+
+func TestGenWorkspaceFlakeParams_HonorsLock(t *testing.T) {
+	lock := &LockFile{
+		Version: lockFileVersion,
+		NixPkgs: map[string]LockedInput{
+			"default":  {Rev: "abc123", NarHash: "sha256-defaultHash+/="},
+			"unstable": {Rev: "stale456", NarHash: "sha256-staleHash="},
+		},
+		FlakeInputs: map[string]LockedInput{
+			flakeUtilsInput: {Rev: "fu789", NarHash: "sha256-flakeUtilsHash="},
+		},
+		URLPackages: map[string]map[string]string{
+			"run": {getOSArch(): "sha256-runHash="},
+		},
+	}
+
+	params, err := genWorkspaceFlakeParams(WorkspaceFlakeGenParams{
+		NixPkgs: NixPkgsMap{"default": "abc123", "unstable": "def456"},
+		Packages: []*NormalizedPackage{
+			{URLPackage: &URLPackage{
+				Name:    "run",
+				Sources: map[string]URLAndSHA{getOSArch(): {URL: "https://example.com/run"}},
+			}},
+		},
+		Lock: lock,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := params.NixPkgsNarHashMap["default"]; got != "sha256-defaultHash+/=" {
+		t.Errorf("default nixpkgs must use locked narHash, got: %q", got)
+	}
+
+	if got, ok := params.NixPkgsNarHashMap["unstable"]; ok {
+		t.Errorf("stale lock entry must be ignored, got: %q", got)
+	}
+
+	if params.FlakeUtils.Rev != "fu789" || params.FlakeUtils.NarHash != "sha256-flakeUtilsHash=" {
+		t.Errorf("flake-utils must be locked, got: %+v", params.FlakeUtils)
+	}
+
+	if len(params.URLPackages) != 1 || params.URLPackages[0].Sha256 != "sha256-runHash=" {
+		t.Errorf("URL package must use locked sha256, got: %+v", params.URLPackages)
+	}
+
+	flake, err := templates.RenderWorkspaceFlake(params)
+	if err != nil {
+		t.Fatalf("failed to render flake: %v", err)
+	}
+
+	for _, want := range []string{
+		`flake-utils.url = "github:numtide/flake-utils/fu789?narHash=sha256-flakeUtilsHash%3D";`,
+		`nixpkgs_default.url = "github:nixos/nixpkgs/abc123?narHash=sha256-defaultHash%2B%2F%3D";`,
+		`nixpkgs_unstable.url = "github:nixos/nixpkgs/def456";`,
+	} {
+		if !bytes.Contains(flake, []byte(want)) {
+			t.Errorf("rendered flake must contain %q, got:\n%s", want, flake[:strings.Index(string(flake), "outputs")])
+		}
+	}
+}
+
+func TestGenWorkspaceFlakeParams_WithoutLock(t *testing.T) {
+	params, err := genWorkspaceFlakeParams(WorkspaceFlakeGenParams{
+		NixPkgs: NixPkgsMap{"default": "abc123"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if params.FlakeUtils.Rev != flakeUtilsRev || params.FlakeUtils.NarHash != "" {
+		t.Errorf("flake-utils must fallback to default revision, got: %+v", params.FlakeUtils)
+	}
+
+	if len(params.NixPkgsNarHashMap) != 0 {
+		t.Errorf("nixpkgs must not have narHash, got: %v", params.NixPkgsNarHashMap)
+	}
+}
@@ -5,11 +5,14 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"sync"
 
+	"github.com/nxtcoder17/nixy/pkg/set"
 	"gopkg.in/yaml.v3"
 )
 
@@ -19,6 +22,7 @@ const (
 	LocalMode          Mode = "local"
 	LocalIgnoreEnvMode Mode = "local-ignore-env"
 	DockerMode         Mode = "docker"
+	PodmanMode         Mode = "podman"
 	BubbleWrapMode     Mode = "bubblewrap"
 )
 
@@ -27,8 +31,8 @@ func (m Mode) String() string {
 }
 
 type NixyMount struct {
-	Source      string `yaml:"source"`
-	Destination string `yaml:"dest"`
+	Source      string `yaml:"source" jsonschema:"required"`
+	Destination string `yaml:"dest" jsonschema:"required"`
 	ReadOnly    bool   `yaml:"readonly,omitempty"`
 }
 
@@ -52,29 +56,76 @@ func (m NixPkgsMap) DefaultCommit() string {
 }
 
 type Nixy struct {
-	NixPkgs   NixPkgsMap           `yaml:"nixpkgs"`
+	// Imports are other nixy files, that are merged into this one.
+	// Paths are relative to the importing file, or `profile:<path>` for files in current nixy profile
+	Imports []string `yaml:"imports,omitempty"`
+
+	NixPkgs   NixPkgsMap           `yaml:"nixpkgs" jsonschema:"required"`
 	Packages  []*NormalizedPackage `yaml:"packages"`
-	Libraries []string             `yaml:"libraries,omitempty"`
+	Libraries []*NormalizedPackage `yaml:"libraries,omitempty"`
 
 	Env map[string]string `yaml:"env,omitempty"`
 
+	// PlatformEnv overrides env on platforms matching the <os>/<arch> pattern (e.g. darwin/*), keyed by that pattern
+	PlatformEnv map[string]map[string]string `yaml:"platformEnv,omitempty"`
+
 	OnShellEnter string `yaml:"onShellEnter,omitempty"`
 
-	// OnShellExit is not used as of now, will try to use it in future
+	// OnShellExit runs when the interactive shell exits (including Ctrl-D and SIGHUP), with the same env as OnShellEnter
 	OnShellExit string `yaml:"onShellExit,omitempty"`
 
 	Builds map[string]Build `yaml:"builds,omitempty"`
 
-	// Mount is applicable only on bubblewrap and docker modes
+	// Overlays are .nix files (relative to the nixy file), applied to every nixpkgs import
+	Overlays []string `yaml:"overlays,omitempty"`
+
+	// NixpkgsConfig is passed as config, to every nixpkgs import (allowUnfree defaults to true)
+	NixpkgsConfig map[string]any `yaml:"nixpkgsConfig,omitempty"`
+
+	// ExtraPackagesExpr is a nix expression evaluating to a list of packages, evaluated `with pkgs;`
+	ExtraPackagesExpr string `yaml:"extraPackagesExpr,omitempty"`
+
+	// Scripts are project scripts, run inside the workspace with `nixy run <name>`
+	Scripts map[string]Script `yaml:"scripts,omitempty"`
+
+	// Shells are named shell variants (e.g. ci, docs), selected with `nixy shell --variant <name>`
+	Shells map[string]ShellVariant `yaml:"shells,omitempty"`
+
+	// Mount is applicable only on bubblewrap, docker and podman modes
 	Mounts []NixyMount `yaml:"mounts,omitempty"`
 
 	// AUTO FILLED
 	sha256Sum string `yaml:"-"`
 
+	// lock holds nixy.lock, found next to nixy.yml (if any)
+	lock *LockFile `yaml:"-"`
+
 	// rawNode holds the original yaml.Node tree for comment preservation
 	rawNode *yaml.Node `yaml:"-"`
 }
 
+// ShellVariant extends the base packages, env and onShellEnter, for a named shell
+type ShellVariant struct {
+	Packages     []*NormalizedPackage `yaml:"packages,omitempty"`
+	Env          map[string]string    `yaml:"env,omitempty"`
+	OnShellEnter string               `yaml:"onShellEnter,omitempty"`
+}
+
+// envForPlatform returns env, along with the overrides from every platformEnv pattern matching osArch
+func (n *Nixy) envForPlatform(osArch string) map[string]string {
+	env := make(map[string]string, len(n.Env))
+	maps.Copy(env, n.Env)
+
+	patterns := slices.Sorted(maps.Keys(n.PlatformEnv))
+	for _, pattern := range patterns {
+		if matchesPlatform([]string{pattern}, osArch) {
+			maps.Copy(env, n.PlatformEnv[pattern])
+		}
+	}
+
+	return env
+}
+
 func (n *Nixy) debug() {
 	b, err := yaml.Marshal(n)
 	if err != nil {
@@ -88,6 +139,7 @@ type NixyWrapper struct {
 	Context *Context
 
 	hasHashChanged bool
+	executor       Executor      `yaml:"-"`
 	executorArgs   *ExecutorArgs `yaml:"-"`
 	sync.Mutex     `yaml:"-"`
 	Logger         *slog.Logger  `yaml:"-"`
@@ -117,6 +169,46 @@ type Build struct {
 	Paths    []string             `yaml:"paths"`
 }
 
+// NixyFileNames are the names of a nixy file, in order of their precedence
+var NixyFileNames = []string{"nixy.yml", "nixy.yaml", ".nixy.yml"}
+
+// lookupNixyFile returns path to the nixy file in dir, if any
+func lookupNixyFile(dir string) (string, bool, error) {
+	for _, fn := range NixyFileNames {
+		if _, err := os.Stat(filepath.Join(dir, fn)); err != nil {
+			if !os.IsNotExist(err) {
+				return "", false, err
+			}
+			continue
+		}
+
+		return filepath.Join(dir, fn), true, nil
+	}
+
+	return "", false, nil
+}
+
+// FindNixyFile walks up from dir, and returns path to the nearest nixy file
+func FindNixyFile(dir string) (string, error) {
+	oldDir := ""
+
+	for oldDir != dir {
+		file, ok, err := lookupNixyFile(dir)
+		if err != nil {
+			return "", err
+		}
+
+		if ok {
+			return file, nil
+		}
+
+		oldDir = dir
+		dir = filepath.Dir(dir)
+	}
+
+	return "", fmt.Errorf("failed to locate your nearest Nixyfile (any of %s)", strings.Join(NixyFileNames, ", "))
+}
+
 type InShellNixy struct {
 	PWD    string `yaml:"-"`
 	Logger *slog.Logger
@@ -129,59 +221,101 @@ func LoadInNixyShell(parent context.Context) (*InShellNixy, error) {
 		return nil, fmt.Errorf("in nixy shell, NIXY_WORKSPACE_DIR must be defined")
 	}
 
-	nixyFile := filepath.Join(workspaceDir, "nixy.yml")
+	// INFO: NIXY_FILE is the nixy file, the shell was started with (e.g. with --file)
+	nixyFile, ok := os.LookupEnv("NIXY_FILE")
+	if !ok || nixyFile == "" {
+		file, found, err := lookupNixyFile(workspaceDir)
+		if err != nil {
+			return nil, err
+		}
 
-	b, err := os.ReadFile(nixyFile)
+		if !found {
+			return nil, fmt.Errorf("no nixy file found in NIXY_WORKSPACE_DIR (%s)", workspaceDir)
+		}
+		nixyFile = file
+	}
+
+	// INFO: builds and env could come from imported files, so imports must be resolved here too
+	nc, err := parseAndSyncNixyFile(parent, nixyFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read nixy file (%s): %w", nixyFile, err)
+		return nil, &ExitError{Code: ExitCodeConfig, Err: err}
 	}
 
-	nixy := InShellNixy{
+	return &InShellNixy{
 		Logger: slog.Default(),
 		PWD:    workspaceDir,
-		Nixy:   Nixy{},
-	}
-
-	if err := yaml.Unmarshal(b, &nixy.Nixy); err != nil {
-		return nil, err
-	}
-
-	return &nixy, nil
+		Nixy:   *nc,
+	}, nil
 }
 
-func parseAndSyncNixyFile(ctx context.Context, file string) (*Nixy, error) {
+// readNixyNode reads the nixy file, and parses it as a yaml.Node tree,
+// so that comments, structure and positions are preserved
+func readNixyNode(file string) ([]byte, *yaml.Node, error) {
 	b, err := os.ReadFile(file)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read nixy file (%s): %w", file, err)
+		return nil, nil, fmt.Errorf("failed to read nixy file (%s): %w", file, err)
 	}
 
-	// Parse as yaml.Node to preserve comments and structure
 	var rootNode yaml.Node
 	if err := yaml.Unmarshal(b, &rootNode); err != nil {
-		return nil, err
+		return nil, nil, fmt.Errorf("failed to parse nixy file (%s): %w", file, err)
 	}
 
-	// Also decode into struct for processing
-	var nixyCfg Nixy
-	if err := rootNode.Decode(&nixyCfg); err != nil {
+	return b, &rootNode, nil
+}
+
+func parseAndSyncNixyFile(ctx context.Context, file string) (*Nixy, error) {
+	hasher := sha256.New()
+	hasher.Write([]byte(os.Getenv("NIXY_VERSION")))
+	// Use NIXY_EXECUTOR to match Context.NixyMode, ensuring different executor modes
+	// always result in distinct workspace hashes
+	hasher.Write([]byte(os.Getenv("NIXY_EXECUTOR")))
+
+	// INFO: nixy.lock pins the workspace inputs, so changing it must regenerate the workspace too
+	var lock *LockFile
+	if lockBytes, err := os.ReadFile(LockFilePath(file)); err == nil {
+		hasher.Write(lockBytes)
+		lock, err = ReadLockFile(LockFilePath(file))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// INFO: every imported file is written to the hasher too, so that editing them triggers regeneration
+	nixyCfg, err := loadNixyFileWithImports(ctx, file, lock, hasher, nil, &set.Set[string]{})
+	if err != nil {
 		return nil, err
 	}
 
-	// Store the raw node for later sync
-	nixyCfg.rawNode = &rootNode
+	nixyCfg.lock = lock
 
 	if _, ok := nixyCfg.NixPkgs["default"]; !ok {
 		return nil, fmt.Errorf("nixy.yml must have a nixpkgs.default key, containing a nixpkgs hash")
 	}
 
-	hasher := sha256.New()
-	hasher.Write([]byte(os.Getenv("NIXY_VERSION")))
-	// Use NIXY_EXECUTOR to match Context.NixyMode, ensuring different executor modes
-	// always result in distinct workspace hashes
-	hasher.Write([]byte(os.Getenv("NIXY_EXECUTOR")))
-	hasher.Write(b)
 	nixyCfg.sha256Sum = fmt.Sprintf("%x", hasher.Sum(nil))[:7]
 
+	return nixyCfg, nil
+}
+
+// loadNixyFile parses a single nixy file (without resolving its imports),
+// and syncs SHA256 of its URL packages back to it (unless ctx is read only, see withReadOnlyNixyFile)
+func loadNixyFile(ctx context.Context, file string, lock *LockFile) (*Nixy, []byte, error) {
+	// Parse as yaml.Node to preserve comments and structure
+	b, rootNode, err := readNixyNode(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Also decode into struct for processing
+	var nixyCfg Nixy
+	if err := rootNode.Decode(&nixyCfg); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode nixy file (%s): %w", file, err)
+	}
+
+	// Store the raw node for later sync
+	nixyCfg.rawNode = rootNode
+
 	hasPkgUpdates := false
 
 	for i, pkg := range nixyCfg.Packages {
@@ -192,18 +326,31 @@ func parseAndSyncNixyFile(ctx context.Context, file string) (*Nixy, error) {
 		// Fetch SHA256 if not provided
 		if pkg.URLPackage != nil {
 			osArch := getOSArch()
-			v, hasSource := pkg.URLPackage.Sources[osArch]
-			if !hasSource || v.URL == "" {
-				return nil, fmt.Errorf("URL package %q has no source defined for %s", pkg.URLPackage.Name, osArch)
+			if !pkg.forPlatform(osArch) {
+				continue
+			}
+
+			v, err := pkg.URLPackage.urlSource(osArch)
+			if err != nil {
+				return nil, nil, err
 			}
 
 			if v.SHA256 != "" {
 				continue
 			}
 
+			if hash := lock.urlPackageSHA256(pkg.URLPackage.Name, osArch); hash != "" {
+				pkg.URLPackage.Sources[osArch] = URLAndSHA{URL: v.URL, SHA256: hash}
+				continue
+			}
+
+			if isReadOnlyNixyFile(ctx) {
+				return nil, nil, fmt.Errorf("URL package %q has no sha256 for %s, run `nixy lock` (or `nixy shell`) to fetch it", pkg.URLPackage.Name, osArch)
+			}
+
 			hash, err := fetchURLPackageHash(ctx, v.URL)
 			if err != nil {
-				return nil, fmt.Errorf("failed to fetch SHA256 hash for (name: %s, url: %s): %w", pkg.URLPackage.Name, v.URL, err)
+				return nil, nil, fmt.Errorf("failed to fetch SHA256 hash for (name: %s, url: %s): %w", pkg.URLPackage.Name, v.URL, err)
 			}
 
 			hasPkgUpdates = true
@@ -214,7 +361,7 @@ func parseAndSyncNixyFile(ctx context.Context, file string) (*Nixy, error) {
 			}
 
 			// Update the SHA256 in the raw node tree
-			if err := updateSHA256InNode(&rootNode, i, osArch, hash); err != nil {
+			if err := updateSHA256InNode(rootNode, i, osArch, hash); err != nil {
 				slog.Warn("failed to update SHA256 in node tree, will regenerate", "error", err)
 				nixyCfg.rawNode = nil
 			}
@@ -223,11 +370,16 @@ func parseAndSyncNixyFile(ctx context.Context, file string) (*Nixy, error) {
 
 	if hasPkgUpdates {
 		if err := nixyCfg.SyncToDisk(file); err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		// INFO: hash must be computed over what is on disk now
+		b, err = os.ReadFile(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read nixy file (%s): %w", file, err)
 		}
 	}
 
-	return &nixyCfg, nil
+	return &nixyCfg, b, nil
 }
 
 func LoadFromFile(parent context.Context, f string) (*NixyWrapper, error) {
@@ -238,13 +390,14 @@ func LoadFromFile(parent context.Context, f string) (*NixyWrapper, error) {
 
 	nc, err := parseAndSyncNixyFile(parent, f)
 	if err != nil {
-		return nil, err
+		return nil, &ExitError{Code: ExitCodeConfig, Err: err}
 	}
 
 	ctx, err := NewContext(parent, filepath.Dir(f))
 	if err != nil {
 		return nil, err
 	}
+	ctx.NixyFile = f
 
 	// Always create runtime paths (needed for workspace flake storage)
 	runtimePaths, err := NewRuntimePaths(ctx.NixyProfile)
@@ -276,7 +429,7 @@ func LoadFromFile(parent context.Context, f string) (*NixyWrapper, error) {
 
 		nc, err := parseAndSyncNixyFile(ctx, profile.ProfileNixyYAMLPath)
 		if err != nil {
-			return nil, err
+			return nil, &ExitError{Code: ExitCodeConfig, Err: err}
 		}
 		hasChanged, err := compareAndSaveHash(filepath.Join(profilePath(ctx.NixyProfile), "nixy.yml.sha256"), nc.sha256Sum)
 		if err != nil {
@@ -288,28 +441,24 @@ func LoadFromFile(parent context.Context, f string) (*NixyWrapper, error) {
 		nixy.hasHashChanged = nixy.hasHashChanged || hasChanged
 	}
 
-	switch ctx.NixyMode {
-	case BubbleWrapMode:
-		nixy.executorArgs, err = UseBubbleWrap(ctx, runtimePaths)
-		if err != nil {
-			return nil, err
-		}
-	case DockerMode:
-		nixy.executorArgs, err = UseDocker(ctx, runtimePaths)
-		if err != nil {
-			return nil, err
-		}
-	case LocalMode:
-		nixy.executorArgs, err = UseLocal(ctx, runtimePaths)
-		if err != nil {
-			return nil, err
-		}
+	nixy.executor, err = lookupExecutor(ctx.NixyMode)
+	if err != nil {
+		return nil, err
+	}
+
+	nixy.executorArgs, err = nixy.executor.Setup(ctx, runtimePaths)
+	if err != nil {
+		return nil, err
 	}
 
 	if _, ok := nixy.NixPkgs["default"]; !ok {
 		return nil, fmt.Errorf("nixy.yml must have a nixpkgs.default key, containing a nixpkgs hash")
 	}
 
+	if err := saveWorkspaceMetadata(nixy.executorArgs.WorkspaceFlakeDirHostPath, ctx.PWD, ctx.NixyMode); err != nil {
+		slog.Warn("failed to save workspace metadata", "err", err)
+	}
+
 	return &nixy, nil
 }
 
@@ -374,16 +523,7 @@ func (nixy *Nixy) SyncToDisk(file string) error {
 			continue
 		}
 
-		var key string
-
-		if pkg.NixPackage != nil {
-			key = pkg.NixPackage.Name
-		}
-
-		if pkg.URLPackage != nil {
-			key = pkg.URLPackage.Name
-		}
-
+		key := packageKey(pkg)
 		if _, ok := set[key]; ok {
 			continue
 		}
@@ -396,6 +536,21 @@ func (nixy *Nixy) SyncToDisk(file string) error {
 	return encoder.Encode(nixy)
 }
 
+// packageKey is the identity of a package, packages with the same key are considered duplicates
+func packageKey(pkg *NormalizedPackage) string {
+	var key string
+
+	if pkg.NixPackage != nil {
+		key = pkg.NixPackage.Name
+	}
+
+	if pkg.URLPackage != nil {
+		key = pkg.URLPackage.Name
+	}
+
+	return key
+}
+
 // YAML Node helper functions for traversing and modifying yaml.Node trees
 
 // findMappingValue finds the value node for a given key in a mapping node.
@@ -440,7 +595,13 @@ func setOrInsertScalarField(node *yaml.Node, key, value, afterKey string) {
 		}
 	}
 
-	// Key doesn't exist, find position to insert after afterKey
+	insertMappingField(node, key, &yaml.Node{Kind: yaml.ScalarNode, Value: value}, afterKey)
+}
+
+// insertMappingField inserts a key with the given value node in a mapping node,
+// right after the specified key. If afterKey is empty or not found, appends to the end.
+func insertMappingField(node *yaml.Node, key string, value *yaml.Node, afterKey string) {
+	// find position to insert after afterKey
 	insertIdx := len(node.Content) // default: append to end
 	if afterKey != "" {
 		for i := 0; i < len(node.Content)-1; i += 2 {
@@ -454,10 +615,7 @@ func setOrInsertScalarField(node *yaml.Node, key, value, afterKey string) {
 	// Insert at the computed position
 	newContent := make([]*yaml.Node, 0, len(node.Content)+2)
 	newContent = append(newContent, node.Content[:insertIdx]...)
-	newContent = append(newContent,
-		&yaml.Node{Kind: yaml.ScalarNode, Value: key},
-		&yaml.Node{Kind: yaml.ScalarNode, Value: value},
-	)
+	newContent = append(newContent, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
 	newContent = append(newContent, node.Content[insertIdx:]...)
 	node.Content = newContent
 }
@@ -0,0 +1,142 @@
+package nixy
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// walkOverlayDir walks the directory of an overlay, i.e. everything the overlay could refer to
+// with a relative path (e.g. ./fix.patch). fn gets paths relative to that directory
+func walkOverlayDir(overlay string, fn func(rel string, d fs.DirEntry) error) error {
+	dir := filepath.Dir(overlay)
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		if rel == "." {
+			return nil
+		}
+
+		return fn(rel, d)
+	})
+}
+
+// hashOverlayDir writes the overlay's directory (files along with their relative paths) to hasher,
+// as the whole directory is copied into the workspace flake
+func hashOverlayDir(hasher io.Writer, overlay string) error {
+	if _, err := os.Stat(overlay); err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(overlay)
+	return walkOverlayDir(overlay, func(rel string, d fs.DirEntry) error {
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(filepath.Join(dir, rel))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hasher, "%s\x00%s\x00", rel, target)
+		case d.Type().IsRegular():
+			b, err := os.ReadFile(filepath.Join(dir, rel))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hasher, "%s\x00", rel)
+			hasher.Write(b)
+		}
+		return nil
+	})
+}
+
+// copyOverlayDir copies the overlay's directory to dest, so that the overlay's relative paths still work there
+func copyOverlayDir(overlay string, dest string) error {
+	if _, err := os.Stat(overlay); err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(overlay)
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return err
+	}
+
+	return walkOverlayDir(overlay, func(rel string, d fs.DirEntry) error {
+		src, dst := filepath.Join(dir, rel), filepath.Join(dest, rel)
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(dst, 0o755)
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(src)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, dst)
+		case d.Type().IsRegular():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+
+			b, err := os.ReadFile(src)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(dst, b, info.Mode().Perm())
+		}
+
+		return nil
+	})
+}
+
+// copyOverlays copies overlays into the workspace flake dir, as flakes can not import files outside of them.
+// Each overlay is copied along with its directory, so that it can refer to files next to it (e.g. ./fix.patch).
+// It returns the overlay paths, relative to the workspace flake dir
+func copyOverlays(flakeDir string, overlays []string) ([]string, error) {
+	overlaysDir := filepath.Join(flakeDir, "overlays")
+	if err := os.RemoveAll(overlaysDir); err != nil {
+		return nil, fmt.Errorf("failed to clean overlays dir: %w", err)
+	}
+
+	if len(overlays) == 0 {
+		return nil, nil
+	}
+
+	// INFO: directories are numbered, as overlays from different directories could have the same name
+	copiedDirs := make(map[string]string, len(overlays))
+
+	result := make([]string, 0, len(overlays))
+	for _, overlay := range overlays {
+		dir := filepath.Dir(overlay)
+		name, ok := copiedDirs[dir]
+		if !ok {
+			if _, isProjectDir, _ := lookupNixyFile(dir); isProjectDir {
+				slog.Warn("overlay is next to a nixy file, so the whole project is copied into the workspace flake, keep it in a directory of its own (e.g. ./nix)", "overlay", overlay)
+			}
+
+			name = fmt.Sprintf("%02d", len(copiedDirs))
+			if err := copyOverlayDir(overlay, filepath.Join(overlaysDir, name)); err != nil {
+				return nil, fmt.Errorf("failed to copy overlay (%s): %w", overlay, err)
+			}
+			copiedDirs[dir] = name
+		}
+
+		result = append(result, "./overlays/"+name+"/"+filepath.Base(overlay))
+	}
+
+	return result, nil
+}
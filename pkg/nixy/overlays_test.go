@@ -0,0 +1,48 @@
+package nixy
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCopyOverlays(t *testing.T) {
+	src := t.TempDir()
+	for name, content := range map[string]string{
+		"nix/fix-jq.nix":   "final: prev: { jq = prev.jq.overrideAttrs (o: { patches = [ ./fix.patch ]; }); }\n",
+		"nix/fix.patch":    "--- a\n+++ b\n",
+		"nix/hello.nix":    "final: prev: {}\n",
+		"nix/.git/HEAD":    "ref: refs/heads/main\n",
+		"other/fix-jq.nix": "final: prev: {}\n",
+	} {
+		if err := os.MkdirAll(filepath.Join(src, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	flakeDir := t.TempDir()
+	got, err := copyOverlays(flakeDir, []string{
+		filepath.Join(src, "nix", "fix-jq.nix"),
+		filepath.Join(src, "nix", "hello.nix"),
+		filepath.Join(src, "other", "fix-jq.nix"),
+	})
+	if err != nil {
+		t.Fatalf("copyOverlays() error = %v", err)
+	}
+
+	if want := []string{"./overlays/00/fix-jq.nix", "./overlays/00/hello.nix", "./overlays/01/fix-jq.nix"}; !slices.Equal(got, want) {
+		t.Errorf("copyOverlays() = %q, want %q", got, want)
+	}
+
+	if _, err := os.Stat(filepath.Join(flakeDir, "overlays", "00", "fix.patch")); err != nil {
+		t.Errorf("files next to an overlay must be copied along, got: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(flakeDir, "overlays", "00", ".git")); !os.IsNotExist(err) {
+		t.Errorf(".git must not be copied, got: %v", err)
+	}
+}
@@ -6,12 +6,16 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"runtime"
 	"slices"
 	"strings"
 	"log/slog"
 	"context"
+	"maps"
+	"regexp"
+	"strconv"
 
 	"github.com/nxtcoder17/nixy/pkg/nixy/templates"
 	"github.com/nxtcoder17/nixy/pkg/set"
@@ -21,22 +25,73 @@ import (
 type NixPackage struct {
 	Name   string
 	Commit string
+
+	// Platforms restricts the package to the matching <os>/<arch> patterns (e.g. linux/*, darwin/arm64).
+	// Empty means every platform
+	Platforms []string
+}
+
+// platformNixPackage is the mapping form of a nix package, i.e. `{nix: glibcLocales, platforms: [linux/*]}`
+type platformNixPackage struct {
+	Nix       string   `yaml:"nix" jsonschema:"required"`
+	Platforms []string `yaml:"platforms,omitempty"`
 }
 
 func getOSArch() string {
 	return fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH)
 }
 
+// matchesPlatform checks if osArch matches any of the platform patterns, no patterns match every platform
+func matchesPlatform(platforms []string, osArch string) bool {
+	if len(platforms) == 0 {
+		return true
+	}
+
+	for _, pattern := range platforms {
+		if ok, _ := path.Match(pattern, osArch); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forPlatform tells if the package is to be installed on the given platform
+func (p *NormalizedPackage) forPlatform(osArch string) bool {
+	if p.URLPackage != nil {
+		return matchesPlatform(p.URLPackage.Platforms, osArch)
+	}
+
+	if p.NixPackage == nil {
+		return true
+	}
+	return matchesPlatform(p.NixPackage.Platforms, osArch)
+}
+
+// urlSource returns the URL package's source for the given platform, it is an error not to have one
+// as the package is for every platform (or for the given platform, as per its platforms)
+func (p *URLPackage) urlSource(osArch string) (URLAndSHA, error) {
+	source, ok := p.Sources[osArch]
+	if !ok || source.URL == "" {
+		return URLAndSHA{}, fmt.Errorf("URL package %q has no source defined for %s (use platforms, to install it only on some platforms)", p.Name, osArch)
+	}
+	return source, nil
+}
+
 type URLAndSHA struct {
-	URL    string `yaml:"url"`
+	URL    string `yaml:"url" jsonschema:"required"`
 	SHA256 string `yaml:"sha256"`
 }
 
 type URLPackage struct {
-	Name        string               `yaml:"name"`
-	Sources     map[string]URLAndSHA `yaml:"sources"`
+	Name        string               `yaml:"name" jsonschema:"required"`
+	Sources     map[string]URLAndSHA `yaml:"sources" jsonschema:"required"`
 	InstallHook string               `yaml:"installHook,omitempty"`
 	BinPaths    []string             `yaml:"binPaths,omitempty"`
+
+	// Platforms restricts the package to the matching <os>/<arch> patterns, same as of nix packages.
+	// Empty means every platform, where it must then have a source
+	Platforms []string `yaml:"platforms,omitempty"`
 }
 
 type NormalizedPackage struct {
@@ -59,6 +114,7 @@ func (s literalString) MarshalYAML() (any, error) {
 type urlPackageYAML struct {
 	Name        string         `yaml:"name"`
 	Sources     orderedSources `yaml:"sources"`
+	Platforms   []string       `yaml:"platforms,omitempty"`
 	BinPaths    []string       `yaml:"binPaths,omitempty"`
 	InstallHook literalString  `yaml:"installHook,omitempty"`
 }
@@ -110,6 +166,27 @@ func (p *NormalizedPackage) UnmarshalYAML(value *yaml.Node) error {
 		return nil
 	}
 
+	if value.Kind == yaml.MappingNode && findMappingValue(value, "nix") != nil {
+		var pnp platformNixPackage
+		if err := value.Decode(&pnp); err != nil {
+			return err
+		}
+
+		for _, pattern := range pnp.Platforms {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid platform pattern %q for package %q: %w", pattern, pnp.Nix, err)
+			}
+		}
+
+		np, err := parseNixPackage(pnp.Nix)
+		if err != nil {
+			return err
+		}
+		np.NixPackage.Platforms = pnp.Platforms
+		*p = *np
+		return nil
+	}
+
 	var urlpkg URLPackage
 	if err := value.Decode(&urlpkg); err != nil {
 		return err
@@ -123,6 +200,12 @@ func (p *NormalizedPackage) UnmarshalYAML(value *yaml.Node) error {
 		return fmt.Errorf("invalid URL package, must specify .sources")
 	}
 
+	for _, pattern := range urlpkg.Platforms {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid platform pattern %q for URL package %q: %w", pattern, urlpkg.Name, err)
+		}
+	}
+
 	for k, v := range urlpkg.Sources {
 		if v.URL == "" {
 			delete(urlpkg.Sources, k)
@@ -137,10 +220,15 @@ func (p *NormalizedPackage) UnmarshalYAML(value *yaml.Node) error {
 
 func (p *NormalizedPackage) MarshalYAML() (any, error) {
 	if p.NixPackage != nil {
-		if p.NixPackage.Commit == "" {
-			return p.NixPackage.Name, nil
+		name := p.NixPackage.Name
+		if p.NixPackage.Commit != "" {
+			name = fmt.Sprintf("nixpkgs/%s#%s", p.NixPackage.Commit, p.NixPackage.Name)
 		}
-		return fmt.Sprintf("nixpkgs/%s#%s", p.NixPackage.Commit, p.NixPackage.Name), nil
+
+		if len(p.NixPackage.Platforms) > 0 {
+			return platformNixPackage{Nix: name, Platforms: p.NixPackage.Platforms}, nil
+		}
+		return name, nil
 	}
 
 	if p.URLPackage != nil {
@@ -150,9 +238,10 @@ func (p *NormalizedPackage) MarshalYAML() (any, error) {
 		}
 
 		out := urlPackageYAML{
-			Name:     p.URLPackage.Name,
-			Sources:  sources,
-			BinPaths: p.URLPackage.BinPaths,
+			Name:      p.URLPackage.Name,
+			Sources:   sources,
+			Platforms: p.URLPackage.Platforms,
+			BinPaths:  p.URLPackage.BinPaths,
 		}
 		if p.URLPackage.InstallHook != "" {
 			out.InstallHook = literalString(p.URLPackage.InstallHook)
@@ -181,15 +270,25 @@ type WorkspaceFlakeGenParams struct {
 	NixPkgs          NixPkgsMap
 	WorkspaceDirPath string
 	Packages         []*NormalizedPackage
-	Libraries        []string
+	Libraries        []*NormalizedPackage
 	Builds           map[string]Build
 	EnvVars          map[string]string
+	Lock             *LockFile
+
+	// Overlays are paths of overlay files, relative to workspace flake dir
+	Overlays          []string
+	NixpkgsConfig     map[string]any
+	ExtraPackagesExpr string
+
+	// Shells are the shell variants, with their env already merged with the base env
+	Shells map[string]ShellVariant
 }
 
 func genWorkspaceFlakeParams(params WorkspaceFlakeGenParams) (*templates.WorkspaceFlakeParams, error) {
 	result := templates.WorkspaceFlakeParams{
 		NixPkgsCommitsList: params.NixPkgs.List(),
 		NixPkgsCommitsMap:  params.NixPkgs,
+		NixPkgsNarHashMap:  map[string]string{},
 		PackagesMap:        map[string][]string{},
 		LibrariesMap:       map[string][]string{},
 		URLPackages:        []templates.URLPackage{},
@@ -197,14 +296,32 @@ func genWorkspaceFlakeParams(params WorkspaceFlakeGenParams) (*templates.Workspa
 		Builds:             map[string]templates.WorkspaceFlakePackgeBuild{},
 		OSArch:             getOSArch(),
 		EnvVars:            params.EnvVars,
+		Overlays:           params.Overlays,
+		ExtraPackagesExpr:  strings.TrimSpace(params.ExtraPackagesExpr),
+	}
+
+	nixpkgsConfig := map[string]any{"allowUnfree": true}
+	maps.Copy(nixpkgsConfig, params.NixpkgsConfig)
+
+	var err error
+	result.NixpkgsConfig, err = toNixValue(nixpkgsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nixpkgsConfig: %w", err)
 	}
 
+	flakeUtils := params.Lock.flakeInput(flakeUtilsInput, flakeUtilsRev)
+	result.FlakeUtils = templates.FlakeInput{Rev: flakeUtils.Rev, NarHash: flakeUtils.NarHash}
+
 	packagesMap := map[string]*set.Set[string]{}
 	librariesMap := map[string]*set.Set[string]{}
 
-	for k := range params.NixPkgs {
+	for k, commit := range params.NixPkgs {
 		packagesMap[k] = &set.Set[string]{}
 		librariesMap[k] = &set.Set[string]{}
+
+		if narHash := params.Lock.nixpkgsNarHash(k, commit); narHash != "" {
+			result.NixPkgsNarHashMap[k] = narHash
+		}
 	}
 
 	for i := range params.Packages {
@@ -213,6 +330,13 @@ func genWorkspaceFlakeParams(params WorkspaceFlakeGenParams) (*templates.Workspa
 			continue
 		}
 
+		if !pkg.forPlatform(result.OSArch) {
+			if pkg.URLPackage != nil {
+				slog.Warn("skipping URL package, as it is not for this platform", "package", pkg.URLPackage.Name, "platform", result.OSArch)
+			}
+			continue
+		}
+
 		if pkg.NixPackage != nil {
 			nixpkg := pkg.NixPackage
 
@@ -224,32 +348,36 @@ func genWorkspaceFlakeParams(params WorkspaceFlakeGenParams) (*templates.Workspa
 		}
 
 		if pkg.URLPackage != nil {
-			source, ok := pkg.URLPackage.Sources[result.OSArch]
-			if !ok || source.URL == "" {
-				return nil, fmt.Errorf("URL package %q has no source defined for %s", pkg.URLPackage.Name, result.OSArch)
+			source, err := pkg.URLPackage.urlSource(result.OSArch)
+			if err != nil {
+				return nil, err
+			}
+
+			sha256 := source.SHA256
+			if sha256 == "" {
+				sha256 = params.Lock.urlPackageSHA256(pkg.URLPackage.Name, result.OSArch)
 			}
 
 			result.URLPackages = append(result.URLPackages, templates.URLPackage{
 				Name:        pkg.URLPackage.Name,
 				URL:         source.URL,
-				Sha256:      source.SHA256,
+				Sha256:      sha256,
 				InstallHook: pkg.URLPackage.InstallHook,
 				BinPaths:    pkg.URLPackage.BinPaths,
 			})
 		}
 	}
 
-	for _, pkg := range params.Libraries {
-		np, err := parseNixPackage(pkg)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse library (%s): %w", pkg, err)
+	for _, lib := range params.Libraries {
+		if lib == nil || !lib.forPlatform(result.OSArch) {
+			continue
 		}
 
-		if np.NixPackage == nil {
-			return nil, fmt.Errorf("library (%s) must be a nix package", pkg)
+		if lib.NixPackage == nil {
+			return nil, fmt.Errorf("library (%s) must be a nix package", packageKey(lib))
 		}
 
-		nixpkg := np.NixPackage
+		nixpkg := lib.NixPackage
 
 		if nixpkg.Commit == "" {
 			nixpkg.Commit = params.NixPkgs.DefaultCommit()
@@ -265,7 +393,7 @@ func genWorkspaceFlakeParams(params WorkspaceFlakeGenParams) (*templates.Workspa
 		}
 
 		for _, pkg := range build.Packages {
-			if pkg.NixPackage != nil {
+			if pkg.NixPackage != nil && pkg.forPlatform(result.OSArch) {
 				nixpkg := pkg.NixPackage
 
 				if nixpkg.Commit == "" {
@@ -279,6 +407,51 @@ func genWorkspaceFlakeParams(params WorkspaceFlakeGenParams) (*templates.Workspa
 		result.Builds[key] = pkgBuild
 	}
 
+	if len(params.Shells) > 0 {
+		result.Shells = make(map[string]templates.DevShell, len(params.Shells))
+	}
+
+	for name, shell := range params.Shells {
+		if !shellVariantNameRegex.MatchString(name) || name == "default" {
+			return nil, fmt.Errorf("invalid shell variant name %q, must match %s and must not be default", name, shellVariantNameRegex)
+		}
+
+		shellPackagesMap := map[string]*set.Set[string]{}
+		for _, pkg := range shell.Packages {
+			if pkg == nil || !pkg.forPlatform(result.OSArch) {
+				continue
+			}
+
+			if pkg.NixPackage == nil {
+				return nil, fmt.Errorf("shell %q: URL packages are not supported in shell variants, add %q to packages instead", name, packageKey(pkg))
+			}
+
+			nixpkg := pkg.NixPackage
+			if nixpkg.Commit == "" {
+				nixpkg.Commit = params.NixPkgs.DefaultCommit()
+			}
+
+			if _, ok := params.NixPkgs[nixpkg.Commit]; !ok {
+				return nil, fmt.Errorf("shell %q: package %q refers to undefined nixpkgs key %q", name, nixpkg.Name, nixpkg.Commit)
+			}
+
+			if shellPackagesMap[nixpkg.Commit] == nil {
+				shellPackagesMap[nixpkg.Commit] = &set.Set[string]{}
+			}
+			shellPackagesMap[nixpkg.Commit].Add(nixpkg.Name)
+		}
+
+		devShell := templates.DevShell{
+			PackagesMap:   make(map[string][]string, len(shellPackagesMap)),
+			EnvVars:       shell.Env,
+			ShellHookFile: shellHookFile(name),
+		}
+		for k, v := range shellPackagesMap {
+			devShell.PackagesMap[k] = v.ToSortedList()
+		}
+		result.Shells[name] = devShell
+	}
+
 	for k, v := range packagesMap {
 		result.PackagesMap[k] = v.ToSortedList()
 	}
@@ -294,6 +467,60 @@ func genWorkspaceFlakeParams(params WorkspaceFlakeGenParams) (*templates.Workspa
 	return &result, nil
 }
 
+var shellVariantNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+var nixIdentifierRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_'-]*$`)
+
+// toNixValue renders a value decoded from yaml, as a nix expression
+func toNixValue(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "null", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case string:
+		return nixString(v), nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := toNixValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return "[ " + strings.Join(items, " ") + " ]", nil
+	case map[string]any:
+		keys := slices.Sorted(maps.Keys(v))
+		attrs := make([]string, 0, len(keys))
+		for _, k := range keys {
+			s, err := toNixValue(v[k])
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", k, err)
+			}
+
+			name := k
+			if !nixIdentifierRegex.MatchString(k) {
+				name = nixString(k)
+			}
+			attrs = append(attrs, fmt.Sprintf("%s = %s;", name, s))
+		}
+		return "{ " + strings.Join(attrs, " ") + " }", nil
+	default:
+		return "", fmt.Errorf("unsupported value %v (%T)", v, v)
+	}
+}
+
+// nixString quotes s as a nix string, escaping the interpolations
+func nixString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", `\${`, "\n", `\n`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
+
 // nixPrefetchResult represents the JSON output from `nix store prefetch-file`
 type nixPrefetchResult struct {
 	Hash      string `json:"hash"`
@@ -314,7 +541,7 @@ func findNixBinary() (string, error) {
 		return staticNixPath, nil
 	}
 
-	return "", fmt.Errorf("nix binary not found in PATH or at %s", staticNixPath)
+	return "", &ExitError{Code: ExitCodeNixNotFound, Err: fmt.Errorf("nix binary not found in PATH or at %s", staticNixPath)}
 }
 
 // fetchURLPackageHash fetches the SHA256 hash of a file at the given URL
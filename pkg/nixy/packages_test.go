@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/nxtcoder17/nixy/pkg/nixy/templates"
 	"gopkg.in/yaml.v3"
 )
 
@@ -293,3 +294,197 @@ func TestNixPackage_MarshalYAML(t *testing.T) {
 		})
 	}
 }
+
+func TestGenWorkspaceFlakeParams_FiltersPlatforms(t *testing.T) {
+	var nc Nixy
+	if err := yaml.Unmarshal([]byte(`nixpkgs:
+  default: abc123
+packages:
+  - go
+  - nix: glibcLocales
+    platforms: [plan9/*]
+  - nix: jq
+    platforms: [plan9/mips, `+getOSArch()+`]
+  - name: acme
+    platforms: [plan9/*]
+    sources:
+      plan9/386:
+        url: https://example.com/acme-plan9-386
+        sha256: abc123
+libraries:
+  - zlib
+  - nix: darwin.apple_sdk
+    platforms: [plan9/*]
+env:
+  EDITOR: vim
+platformEnv:
+  plan9/*:
+    EDITOR: acme
+`), &nc); err != nil {
+		t.Fatalf("failed to parse nixy.yml: %v", err)
+	}
+
+	params, err := genWorkspaceFlakeParams(WorkspaceFlakeGenParams{
+		NixPkgs:   nc.NixPkgs,
+		Packages:  nc.Packages,
+		Libraries: nc.Libraries,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got, want := params.PackagesMap["default"], []string{"go", "jq"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("packages mismatch, got: %v, want: %v", got, want)
+	}
+
+	if got, want := params.LibrariesMap["default"], []string{"zlib"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("libraries mismatch, got: %v, want: %v", got, want)
+	}
+
+	if len(params.URLPackages) != 0 {
+		t.Errorf("URL package not for %s must be skipped, got: %+v", getOSArch(), params.URLPackages)
+	}
+
+	// INFO: without platforms, a missing source is a mistake (e.g. a typo in the platform), not a skip
+	_, err = genWorkspaceFlakeParams(WorkspaceFlakeGenParams{
+		NixPkgs: nc.NixPkgs,
+		Packages: []*NormalizedPackage{{URLPackage: &URLPackage{
+			Name:    "acme",
+			Sources: map[string]URLAndSHA{"linux/amd46": {URL: "https://example.com/acme", SHA256: "abc123"}},
+		}}},
+	})
+	if err == nil {
+		t.Errorf("URL package without a source for %s, and without platforms, must fail", getOSArch())
+	}
+
+	if got := nc.envForPlatform(getOSArch())["EDITOR"]; got != "vim" {
+		t.Errorf("EDITOR must not be overridden on %s, got: %q", getOSArch(), got)
+	}
+
+	if got := nc.envForPlatform("plan9/386")["EDITOR"]; got != "acme" {
+		t.Errorf("EDITOR must be overridden on plan9/386, got: %q", got)
+	}
+}
+
+func Test_toNixValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name: "nixpkgs config",
+			input: `
+cudaSupport: true
+permittedInsecurePackages:
+  - openssl-1.1.1w
+android_sdk.accept_license: true
+maxJobs: 4
+`,
+			want: `{ "android_sdk.accept_license" = true; cudaSupport = true; maxJobs = 4; permittedInsecurePackages = [ "openssl-1.1.1w" ]; }`,
+		},
+		{
+			name:  "strings are escaped",
+			input: `value: "say \"hi\" to ${USER}\n"`,
+			want:  `{ value = "say \"hi\" to \${USER}\n"; }`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v map[string]any
+			if err := yaml.Unmarshal([]byte(tt.input), &v); err != nil {
+				t.Fatalf("failed to parse input: %v", err)
+			}
+
+			got, err := toNixValue(v)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("mismatch:\ngot:  %s\nwant: %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenWorkspaceFlakeParams_RawNix(t *testing.T) {
+	params, err := genWorkspaceFlakeParams(WorkspaceFlakeGenParams{
+		NixPkgs:           NixPkgsMap{"default": "abc123"},
+		Overlays:          []string{"./overlays/00/fix-jq.nix"},
+		NixpkgsConfig:     map[string]any{"cudaSupport": true},
+		ExtraPackagesExpr: "[ (writeShellScriptBin \"hello\" \"echo hi\") ]\n",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	flake, err := templates.RenderWorkspaceFlake(params)
+	if err != nil {
+		t.Fatalf("failed to render flake: %v", err)
+	}
+
+	for _, want := range []string{
+		`nixpkgsConfig = { allowUnfree = true; cudaSupport = true; };`,
+		`(import ./overlays/00/fix-jq.nix)`,
+		`] ++ (with pkgs; [ (writeShellScriptBin "hello" "echo hi") ])`,
+	} {
+		if !bytes.Contains(flake, []byte(want)) {
+			t.Errorf("rendered flake must contain %q", want)
+		}
+	}
+}
+
+func TestGenWorkspaceFlakeParams_ShellVariants(t *testing.T) {
+	var nc Nixy
+	if err := yaml.Unmarshal([]byte(`nixpkgs:
+  default: abc123
+  unstable: def456
+packages:
+  - go
+shells:
+  docs:
+    packages:
+      - mdbook
+      - unstable#vale
+    env:
+      DOCS_PORT: "3000"
+`), &nc); err != nil {
+		t.Fatalf("failed to parse nixy.yml: %v", err)
+	}
+
+	params, err := genWorkspaceFlakeParams(WorkspaceFlakeGenParams{
+		NixPkgs:  nc.NixPkgs,
+		Packages: nc.Packages,
+		Shells:   nc.Shells,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	flake, err := templates.RenderWorkspaceFlake(params)
+	if err != nil {
+		t.Fatalf("failed to render flake: %v", err)
+	}
+
+	for _, want := range []string{
+		`devShells.default = pkgs.mkShell {`,
+		`devShells."docs" = pkgs.mkShell {`,
+		"buildInputs = packages ++ urlPackages ++ [\n            pkgs_default.mdbook\n            pkgs_unstable.vale\n          ];",
+		`export NIXY_SHELL_VARIANT="docs"`,
+		`export DOCS_PORT="3000"`,
+		`source "shell-hook-docs.sh"`,
+	} {
+		if !bytes.Contains(flake, []byte(want)) {
+			t.Errorf("rendered flake must contain %q", want)
+		}
+	}
+
+	if _, err := genWorkspaceFlakeParams(WorkspaceFlakeGenParams{
+		NixPkgs: nc.NixPkgs,
+		Shells:  map[string]ShellVariant{"default": {}},
+	}); err == nil {
+		t.Errorf("expected error, as default is not a valid shell variant name")
+	}
+}
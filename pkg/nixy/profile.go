@@ -7,14 +7,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/nxtcoder17/nixy/pkg/nixy/templates"
-	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
 )
 
 // Profile represents a user profile configuration (only used when NIXY_USE_PROFILE=true)
@@ -33,7 +35,7 @@ var (
 
 // GetProfile loads an existing profile from disk
 func GetProfile(_ *Context, name string) (*Profile, error) {
-	profileJSONPath := filepath.Join(XDGDataDir(), "profiles", name, "profile.json")
+	profileJSONPath := filepath.Join(profilePath(name), "profile.json")
 
 	if !exists(profileJSONPath) {
 		return nil, fmt.Errorf("profile path does not exist")
@@ -61,8 +63,9 @@ func NewProfile(ctx *Context, name string, runtimePaths *RuntimePaths) (*Profile
 
 	profilePath := runtimePaths.BasePath
 
+	// INFO: without anyone to ask (e.g. in CI), profile is created without a nixpkgs pin, unless --yes is passed
 	var nixPkgsHash string
-	if term.IsTerminal(int(os.Stdout.Fd())) {
+	if ctx.AssumeYes || ctx.IsInteractive() {
 		var err error
 		nixPkgsHash, err = fetchCurrentNixpkgsHash(ctx)
 		if err != nil {
@@ -112,26 +115,264 @@ func (p *Profile) Save() error {
 	return os.WriteFile(filepath.Join(p.ProfilePath, "profile.json"), b, 0o644)
 }
 
+// ProfileListItem is a profile, as listed by ProfileList
+type ProfileListItem struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+
+	// NixPkgsCommitHash is the nixpkgs pin of the profile, empty if it has no profile.json
+	NixPkgsCommitHash string `json:"nixpkgs,omitempty"`
+}
+
 // ProfileList returns all available profiles
-func ProfileList(ctx context.Context) ([]string, error) {
-	de, err := os.ReadDir(filepath.Join(XDGDataDir(), "profiles"))
+func ProfileList(ctx context.Context) ([]ProfileListItem, error) {
+	de, err := os.ReadDir(profileBasePath)
 	if err != nil {
 		return nil, err
 	}
 
-	profiles := make([]string, 0, len(de))
+	profiles := make([]ProfileListItem, 0, len(de))
 
 	for i := range de {
 		if de[i].Type().IsDir() {
-			profiles = append(profiles, de[i].Name())
+			profiles = append(profiles, profileListItem(de[i].Name()))
 		}
 	}
 
 	return profiles, nil
 }
 
+func profileListItem(name string) ProfileListItem {
+	item := ProfileListItem{Name: name, Path: profilePath(name)}
+	if p, err := GetProfile(nil, name); err == nil {
+		item.NixPkgsCommitHash = p.NixPkgsCommitHash
+	}
+	return item
+}
+
+// ProfileDetails is everything about a profile, as shown by ProfileShow
+type ProfileDetails struct {
+	ProfileListItem
+
+	// Packages are from the profile's nixy.yml
+	Packages       []string `json:"packages"`
+	WorkspaceCount int      `json:"workspaceCount"`
+
+	// DiskUsage is the size of the profile dir in bytes, of which NixStoreDiskUsage is its nix store
+	DiskUsage         int64 `json:"diskUsage"`
+	NixStoreDiskUsage int64 `json:"nixStoreDiskUsage"`
+}
+
+// ProfileShow returns details of the profile
+func ProfileShow(ctx context.Context, name string) (*ProfileDetails, error) {
+	if err := validateProfileName(name); err != nil {
+		return nil, err
+	}
+
+	if !exists(profilePath(name)) {
+		return nil, fmt.Errorf("profile %q does not exist", name)
+	}
+
+	details := ProfileDetails{ProfileListItem: profileListItem(name)}
+
+	if b, err := os.ReadFile(filepath.Join(details.Path, "nixy.yml")); err == nil {
+		var nc struct {
+			Packages []*NormalizedPackage `yaml:"packages"`
+		}
+		if err := yaml.Unmarshal(b, &nc); err != nil {
+			return nil, fmt.Errorf("failed to parse profile's nixy.yml: %w", err)
+		}
+		for _, pkg := range nc.Packages {
+			details.Packages = append(details.Packages, packageKey(pkg))
+		}
+	}
+
+	if de, err := os.ReadDir(filepath.Join(details.Path, "workspaces")); err == nil {
+		for i := range de {
+			if de[i].IsDir() {
+				details.WorkspaceCount++
+			}
+		}
+	}
+
+	var err error
+	details.DiskUsage, err = dirSize(details.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	details.NixStoreDiskUsage, err = dirSize(filepath.Join(details.Path, "nix"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &details, nil
+}
+
+// ProfileRemove removes the profile, along with its nix store, after confirming with the user
+func ProfileRemove(ctx context.Context, name string) error {
+	if err := validateProfileName(name); err != nil {
+		return err
+	}
+
+	path := profilePath(name)
+	if !exists(path) {
+		return fmt.Errorf("profile %q does not exist", name)
+	}
+
+	storeSize, err := dirSize(filepath.Join(path, "nix"))
+	if err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Remove profile %q (%s) ?", name, path)
+	if storeSize > 0 {
+		message = fmt.Sprintf("Remove profile %q (%s), along with its nix store of %s ?", name, path, HumanizeBytes(storeSize))
+	}
+
+	nixyCtx, err := NewContext(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	ok, err := nixyCtx.Confirm(message)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return fmt.Errorf("User aborted removing profile %q", name)
+	}
+
+	return forceRemoveAll(path)
+}
+
+// ProfileRename renames the profile, keeping its nix store and workspaces
+func ProfileRename(ctx context.Context, oldName, newName string) error {
+	for _, name := range []string{oldName, newName} {
+		if err := validateProfileName(name); err != nil {
+			return err
+		}
+	}
+
+	if !exists(profilePath(oldName)) {
+		return fmt.Errorf("profile %q does not exist", oldName)
+	}
+
+	if exists(profilePath(newName)) {
+		return fmt.Errorf("profile %q already exists", newName)
+	}
+
+	if err := os.Rename(profilePath(oldName), profilePath(newName)); err != nil {
+		return err
+	}
+
+	return relocateProfileJSON(newName)
+}
+
+// relocateProfileJSON updates profile.json of a profile, that has been moved to profilePath(name)
+func relocateProfileJSON(name string) error {
+	p, err := GetProfile(nil, name)
+	if err != nil {
+		// INFO: profiles only used for runtime paths (i.e. without NIXY_USE_PROFILE), have no profile.json
+		return nil
+	}
+
+	p.Name = name
+	p.ProfilePath = profilePath(name)
+	p.ProfileNixyYAMLPath = filepath.Join(p.ProfilePath, "nixy.yml")
+
+	if err := p.Save(); err != nil {
+		return fmt.Errorf("failed to update profile.json: %w", err)
+	}
+
+	return nil
+}
+
+var profileNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// validateProfileName ensures, that the profile dir of name is a direct child of profileBasePath.
+// INFO: "." and ".." match profileNameRegex, but resolve to the nixy data dir (or profiles dir), which must never be removed
+func validateProfileName(name string) error {
+	if !profileNameRegex.MatchString(name) || name == "." || name == ".." {
+		return fmt.Errorf("invalid profile name %q, must match %s, and must not be . or ..", name, profileNameRegex)
+	}
+
+	if filepath.Dir(profilePath(name)) != filepath.Clean(profileBasePath) {
+		return fmt.Errorf("invalid profile name %q, it must resolve to a dir in %s", name, profileBasePath)
+	}
+
+	return nil
+}
+
+// dirSize returns the size of all files in dir, 0 if dir does not exist
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// HumanizeBytes renders n bytes, in a human readable unit (e.g. 1.5 GiB)
+func HumanizeBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// forceRemoveAll removes path, even when it contains read only dirs (as in a nix store)
+func forceRemoveAll(path string) error {
+	// INFO: nix store dirs are read only, so files inside them can not be removed, until they are made writable
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		if d.IsDir() {
+			return os.Chmod(p, 0o755)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to make %s writable: %w", path, err)
+	}
+
+	return os.RemoveAll(path)
+}
+
 // ProfileCreate creates a new profile with the given name
 func ProfileCreate(ctx context.Context, name string) error {
+	if err := validateProfileName(name); err != nil {
+		return err
+	}
+
 	nixyCtx, err := NewContext(ctx, "")
 	if err != nil {
 		return err
@@ -180,13 +421,30 @@ func ProfileEdit(ctx context.Context, name string) error {
 	return nil
 }
 
+const (
+	DefaultGitHubAPI      = "https://api.github.com"
+	DefaultNixpkgsChannel = "nixos-unstable"
+)
+
 // fetchCurrentNixpkgsHash fetches the latest nixpkgs commit hash
-func fetchCurrentNixpkgsHash(ctx context.Context) (string, error) {
-	if !askUser("Fetching Current NixPkgs Version ?") {
+func fetchCurrentNixpkgsHash(ctx *Context) (string, error) {
+	ok, err := ctx.Confirm("Fetching Current NixPkgs Version ?")
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
 		return "", fmt.Errorf("User Aborted fetching current nixpkgs version")
 	}
 
-	r, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.github.com/repos/nixos/nixpkgs/commits/nixos-unstable", nil)
+	return fetchNixpkgsCommit(ctx, DefaultGitHubAPI, DefaultNixpkgsChannel)
+}
+
+// fetchNixpkgsCommit fetches the latest commit of a nixpkgs channel (or branch), via GitHub API
+func fetchNixpkgsCommit(ctx context.Context, githubAPI string, channel string) (string, error) {
+	url := fmt.Sprintf("%s/repos/nixos/nixpkgs/commits/%s", strings.TrimSuffix(githubAPI, "/"), channel)
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return "", err
 	}
@@ -195,6 +453,11 @@ func fetchCurrentNixpkgsHash(ctx context.Context) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch latest commit of nixpkgs %s (url: %s): %s", channel, url, resp.Status)
+	}
 
 	var result struct {
 		SHA string `json:"sha"`
@@ -203,7 +466,10 @@ func fetchCurrentNixpkgsHash(ctx context.Context) (string, error) {
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return "", err
 	}
-	resp.Body.Close()
+
+	if result.SHA == "" {
+		return "", fmt.Errorf("no commit found for nixpkgs %s (url: %s)", channel, url)
+	}
 
 	return result.SHA, nil
 }
@@ -233,14 +499,19 @@ func downloader(msg string, reader io.Reader, writer io.Writer) error {
 }
 
 // downloadStaticNixBinary downloads the static nix binary for bubblewrap profiles
-func downloadStaticNixBinary(ctx context.Context, binPath string) error {
+func downloadStaticNixBinary(ctx *Context, binPath string) error {
 	_, err := os.Stat(binPath)
 	if err == nil {
 		fmt.Println("PATH already exists")
 		return nil
 	}
 
-	if !askUser(fmt.Sprintf("Downloading Static Nix Binary to %s ? ", binPath)) {
+	ok, err := ctx.Confirm(fmt.Sprintf("Downloading Static Nix Binary to %s ? ", binPath))
+	if err != nil {
+		return err
+	}
+
+	if !ok {
 		return fmt.Errorf("User did not allow downloading static nix binary")
 	}
 
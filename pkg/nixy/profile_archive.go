@@ -0,0 +1,481 @@
+package nixy
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/nxtcoder17/nixy/pkg/set"
+)
+
+// FakeHomeExportIncludes are the only paths (relative to fake-home) exported by default, as anything else
+// (e.g. .npmrc, .config/gh) could hold credentials, and the archive is meant to be shared
+var FakeHomeExportIncludes = []string{".gitconfig", ".config/nix"}
+
+type archiveFormat string
+
+const (
+	archiveFormatTar  archiveFormat = "tar"
+	archiveFormatGzip archiveFormat = "gzip"
+	archiveFormatZstd archiveFormat = "zstd"
+)
+
+// archiveFormatOf returns the archive format, as per file extension
+func archiveFormatOf(file string) (archiveFormat, error) {
+	switch {
+	case strings.HasSuffix(file, ".tar.gz"), strings.HasSuffix(file, ".tgz"):
+		return archiveFormatGzip, nil
+	case strings.HasSuffix(file, ".tar.zst"), strings.HasSuffix(file, ".tzst"):
+		return archiveFormatZstd, nil
+	case strings.HasSuffix(file, ".tar"):
+		return archiveFormatTar, nil
+	default:
+		return "", fmt.Errorf("unsupported archive %s, must be one of .tar.zst, .tar.gz or .tar", file)
+	}
+}
+
+// cmdPipe is the stdin (or stdout) of a command, closing it waits for the command to exit
+type cmdPipe struct {
+	io.Closer
+	cmd *exec.Cmd
+}
+
+func (p *cmdPipe) Close() error {
+	if err := p.Closer.Close(); err != nil {
+		return err
+	}
+	return p.cmd.Wait()
+}
+
+type cmdWriter struct {
+	io.Writer
+	cmdPipe
+}
+
+type cmdReader struct {
+	io.Reader
+	cmdPipe
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// compressWriter returns a writer, that compresses (as per format) into w
+func compressWriter(ctx context.Context, format archiveFormat, w io.Writer) (io.WriteCloser, error) {
+	switch format {
+	case archiveFormatGzip:
+		return gzip.NewWriter(w), nil
+	case archiveFormatZstd:
+		// INFO: zstd is not in go stdlib, so the zstd binary is used instead
+		cmd := exec.CommandContext(ctx, "zstd", "-q", "-c", "-T0")
+		cmd.Stdout = w
+		cmd.Stderr = os.Stderr
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("failed to run zstd, is it installed?: %w", err)
+		}
+		return &cmdWriter{Writer: stdin, cmdPipe: cmdPipe{Closer: stdin, cmd: cmd}}, nil
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+// decompressReader returns a reader, that decompresses (as per format) from r
+func decompressReader(ctx context.Context, format archiveFormat, r io.Reader) (io.ReadCloser, error) {
+	switch format {
+	case archiveFormatGzip:
+		return gzip.NewReader(r)
+	case archiveFormatZstd:
+		cmd := exec.CommandContext(ctx, "zstd", "-q", "-d", "-c")
+		cmd.Stdin = r
+		cmd.Stderr = os.Stderr
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("failed to run zstd, is it installed?: %w", err)
+		}
+		return &cmdReader{Reader: stdout, cmdPipe: cmdPipe{Closer: stdout, cmd: cmd}}, nil
+	default:
+		return io.NopCloser(r), nil
+	}
+}
+
+// ProfileExport writes the profile (profile.json, nixy.yml and fake-home dotfiles) as an archive to output,
+// compressed as per its extension. Only FakeHomeExportIncludes, along with include, are exported from fake-home.
+// withStore includes the profile's whole private nix dir (store, its db and profiles) too, not just the closure of its packages.
+// It fails on symlinks which can not be exported, i.e. ones that point outside the nix store
+func ProfileExport(ctx context.Context, name string, output string, withStore bool, include []string) error {
+	format, err := archiveFormatOf(output)
+	if err != nil {
+		return err
+	}
+
+	if err := validateProfileName(name); err != nil {
+		return err
+	}
+
+	dir := profilePath(name)
+	if !exists(dir) {
+		return fmt.Errorf("profile %q does not exist", name)
+	}
+
+	tmp := output + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	cw, err := compressWriter(ctx, format, f)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(cw)
+
+	for _, file := range []string{"profile.json", "nixy.yml"} {
+		if !exists(filepath.Join(dir, file)) {
+			continue
+		}
+		if err := addToTar(tw, dir, file, nil); err != nil {
+			return err
+		}
+	}
+
+	var seen set.Set[string]
+	for _, p := range append(slices.Clone(FakeHomeExportIncludes), include...) {
+		p = filepath.Clean(p)
+		if !filepath.IsLocal(p) {
+			return fmt.Errorf("invalid fake-home path %q, must be relative to fake-home", p)
+		}
+
+		if seen.Has(p) || !exists(filepath.Join(dir, "fake-home", p)) {
+			continue
+		}
+		seen.Add(p)
+
+		if err := addToTar(tw, dir, filepath.Join("fake-home", p), nil); err != nil {
+			return err
+		}
+	}
+
+	if withStore {
+		if !exists(filepath.Join(dir, "nix", "store")) {
+			return fmt.Errorf("profile %q has no private nix store, to export with --with-store", name)
+		}
+		// INFO: auto gcroots are links to result dirs on the exporter's machine, they root nothing on another machine
+		skipAutoRoots := func(rel string) bool {
+			return filepath.ToSlash(rel) == "nix/var/nix/gcroots/auto"
+		}
+		if err := addToTar(tw, dir, "nix", skipAutoRoots); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	if err := cw.Close(); err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, output)
+}
+
+// isNixSymlink tells if a symlink at name (relative to profile dir) pointing to link, is part of the profile's private nix dir,
+// i.e. either inside nix store, or pointing into it (like nix/var/nix/profiles/*)
+func isNixSymlink(name string, link string) bool {
+	if strings.HasPrefix(name, "nix/store/") {
+		return true
+	}
+
+	if !strings.HasPrefix(name, "nix/") {
+		return false
+	}
+
+	if path.IsAbs(link) {
+		return strings.HasPrefix(path.Clean(link), "/nix/store/")
+	}
+
+	return strings.HasPrefix(path.Join(path.Dir(name), link), "nix/")
+}
+
+// addToTar adds rel (relative to baseDir) recursively to tw, leaving out paths for which skip returns true
+func addToTar(tw *tar.Writer, baseDir string, rel string, skip func(rel string) bool) error {
+	return filepath.WalkDir(filepath.Join(baseDir, rel), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(baseDir, p)
+		if err != nil {
+			return err
+		}
+
+		if skip != nil && skip(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+			// INFO: any other symlink points into the exporter's machine, and is refused by ProfileImport anyway
+			if !isNixSymlink(filepath.ToSlash(rel), link) {
+				return fmt.Errorf("can not export symlink %s (-> %s), only symlinks into nix store can be exported", p, link)
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		// INFO: owner is meaningless on another machine
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// ProfileImport creates a profile from an archive (as exported by ProfileExport), and returns its name.
+// name defaults to the name of exported profile
+func ProfileImport(ctx context.Context, archive string, name string) (string, error) {
+	format, err := archiveFormatOf(archive)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	r, err := decompressReader(ctx, format, f)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	if err := os.MkdirAll(profileBasePath, 0o755); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.MkdirTemp(profileBasePath, ".import-*")
+	if err != nil {
+		return "", err
+	}
+	defer forceRemoveAll(tmp)
+
+	if err := extractTar(tar.NewReader(r), tmp); err != nil {
+		return "", fmt.Errorf("failed to extract %s: %w", archive, err)
+	}
+
+	if name == "" {
+		b, err := os.ReadFile(filepath.Join(tmp, "profile.json"))
+		if err != nil {
+			return "", fmt.Errorf("archive has no profile.json, specify a name for the profile: %w", err)
+		}
+
+		var p Profile
+		if err := json.Unmarshal(b, &p); err != nil {
+			return "", fmt.Errorf("invalid profile.json in archive: %w", err)
+		}
+		name = p.Name
+	}
+
+	if err := validateProfileName(name); err != nil {
+		return "", err
+	}
+
+	if exists(profilePath(name)) {
+		return "", fmt.Errorf("profile %q already exists", name)
+	}
+
+	if err := os.Rename(tmp, profilePath(name)); err != nil {
+		return "", err
+	}
+
+	if err := relocateProfileJSON(name); err != nil {
+		return "", err
+	}
+
+	// INFO: creates dirs, that were not part of the archive (e.g. nix store, when exported without --with-store)
+	if _, err := NewRuntimePaths(name); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// extractTar extracts tr into dir, refusing entries which would escape dir (either by path, or via a symlink),
+// and symlinks outside nix dir, or not pointing into nix store
+func extractTar(tr *tar.Reader, dir string) error {
+	symlinks := map[string]bool{}
+	dirModes := map[string]fs.FileMode{}
+
+	// INFO: only dirs created here are chmod-ed, so that an entry never changes the mode of an existing dir (or a symlink's target)
+	created := map[string]bool{}
+	mkdirAll := func(d string) error {
+		var missing []string
+		for p := d; ; p = filepath.Dir(p) {
+			if _, err := os.Lstat(p); err == nil {
+				break
+			} else if !os.IsNotExist(err) {
+				return err
+			}
+			missing = append(missing, p)
+		}
+
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			return err
+		}
+		for _, p := range missing {
+			created[p] = true
+		}
+		return nil
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+
+		name := path.Clean(hdr.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("invalid path %q in archive", hdr.Name)
+		}
+
+		if symlinks[name] {
+			return fmt.Errorf("invalid path %q in archive, it is already a symlink", hdr.Name)
+		}
+
+		for p := path.Dir(name); p != "."; p = path.Dir(p) {
+			if symlinks[p] {
+				return fmt.Errorf("invalid path %q in archive, it is inside a symlink", hdr.Name)
+			}
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(name))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if fi, err := os.Lstat(target); err == nil && fi.Mode()&fs.ModeSymlink != 0 {
+				return fmt.Errorf("invalid path %q in archive, it is a symlink", hdr.Name)
+			}
+			if err := mkdirAll(target); err != nil {
+				return err
+			}
+			if created[target] {
+				dirModes[target] = hdr.FileInfo().Mode().Perm()
+			}
+		case tar.TypeReg:
+			if err := mkdirAll(filepath.Dir(target)); err != nil {
+				return err
+			}
+
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+
+			if err := os.Chmod(target, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			// INFO: profile.json (and nixy.yml) are read, and written to, by nixy. A symlink there (or in fake-home)
+			// would have nixy write through it, to any file of the user. Only nix dir has symlinks of its own
+			if !isNixSymlink(name, hdr.Linkname) {
+				return fmt.Errorf("invalid symlink %q in archive, symlinks are only allowed in nix/store, or into it", hdr.Name)
+			}
+			if err := mkdirAll(filepath.Dir(target)); err != nil {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+			symlinks[name] = true
+		default:
+			return fmt.Errorf("unsupported entry %q (type %c) in archive", hdr.Name, hdr.Typeflag)
+		}
+	}
+
+	// INFO: dirs (e.g. of nix store) could be read only, so their modes are set after everything inside them is extracted
+	dirs := make([]string, 0, len(dirModes))
+	for d := range dirModes {
+		dirs = append(dirs, d)
+	}
+	slices.SortFunc(dirs, func(a, b string) int { return len(b) - len(a) })
+
+	for _, d := range dirs {
+		if err := os.Chmod(d, dirModes[d]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package nixy
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProfileExportImport(t *testing.T) {
+	tmp := t.TempDir()
+	oldBase := profileBasePath
+	profileBasePath = filepath.Join(tmp, "profiles")
+	t.Cleanup(func() { profileBasePath = oldBase })
+
+	rp, err := NewRuntimePaths("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := Profile{Name: "work", NixPkgsCommitHash: "abc123", ProfilePath: rp.BasePath, ProfileNixyYAMLPath: filepath.Join(rp.BasePath, "nixy.yml")}
+	if err := p.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"nixy.yml":                        "packages:\n  - which\n",
+		"fake-home/.gitconfig":            "[user]\n  name = nixy\n",
+		"fake-home/.config/nix/nix.conf":  "experimental-features = nix-command flakes\n",
+		"fake-home/.bash_history":         "secret command\n",
+		"fake-home/.npmrc":                "//registry.npmjs.org/:_authToken=secret\n",
+		"fake-home/.config/gh/hosts.yml":  "oauth_token: secret\n",
+		"fake-home/.config/starship.toml": "add_newline = false\n",
+		"fake-home/.ssh/id_ed25519":       "private key\n",
+		"fake-home/.cache/big":            "cache\n",
+		"nix/store/xyz-hello/bin/hello":   "#!/bin/sh\necho hello\n",
+		"nix/var/nix/db/db.sqlite":        "db",
+	}
+	for name, content := range files {
+		file := filepath.Join(rp.BasePath, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"nix/store/hello":                           "xyz-hello/bin/hello",
+		"nix/var/nix/profiles/default-1-link":       "/nix/store/xyz-hello",
+		"nix/var/nix/profiles/default":              "default-1-link",
+		"nix/var/nix/gcroots/auto/0a1b2c3d4e5f6a7b": "/home/user/project/result",
+	} {
+		if err := os.MkdirAll(filepath.Join(rp.BasePath, filepath.Dir(link)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, filepath.Join(rp.BasePath, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// INFO: nix store dirs are read only
+	if err := os.Chmod(filepath.Join(rp.BasePath, "nix", "store", "xyz-hello"), 0o555); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		importAs   string
+		withStore  bool
+		include    []string
+		wantExists []string
+		wantAbsent []string
+	}{
+		{
+			name:       "without store",
+			importAs:   "teammate",
+			wantExists: []string{"profile.json", "nixy.yml", "fake-home/.gitconfig", "fake-home/.config/nix/nix.conf"},
+			wantAbsent: []string{"fake-home/.bash_history", "fake-home/.ssh", "fake-home/.cache/big", "fake-home/.npmrc", "fake-home/.config/gh", "fake-home/.config/starship.toml", "nix/store/xyz-hello"},
+		},
+		{
+			name:       "with extra fake-home paths",
+			importAs:   "teammate-with-starship",
+			include:    []string{".config/starship.toml", ".gitconfig"},
+			wantExists: []string{"fake-home/.gitconfig", "fake-home/.config/starship.toml"},
+			wantAbsent: []string{"fake-home/.config/gh", "fake-home/.npmrc"},
+		},
+		{
+			name:       "with store",
+			importAs:   "teammate-with-store",
+			withStore:  true,
+			wantExists: []string{"nix/store/xyz-hello/bin/hello", "nix/store/hello", "nix/var/nix/db/db.sqlite", "nix/var/nix/profiles/default", "nix/var/nix/profiles/default-1-link"},
+			wantAbsent: []string{"nix/var/nix/gcroots/auto/0a1b2c3d4e5f6a7b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := filepath.Join(tmp, tt.importAs+".tar.gz")
+			if err := ProfileExport(context.TODO(), "work", archive, tt.withStore, tt.include); err != nil {
+				t.Fatalf("ProfileExport() error = %v", err)
+			}
+
+			name, err := ProfileImport(context.TODO(), archive, tt.importAs)
+			if err != nil {
+				t.Fatalf("ProfileImport() error = %v", err)
+			}
+
+			for _, f := range tt.wantExists {
+				if _, err := os.Lstat(filepath.Join(profilePath(name), f)); err != nil {
+					t.Errorf("expected %s in imported profile: %v", f, err)
+				}
+			}
+			for _, f := range tt.wantAbsent {
+				if exists(filepath.Join(profilePath(name), f)) {
+					t.Errorf("%s must not be exported", f)
+				}
+			}
+
+			imported, err := GetProfile(nil, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if imported.Name != tt.importAs || imported.ProfilePath != profilePath(tt.importAs) || imported.NixPkgsCommitHash != "abc123" {
+				t.Errorf("imported profile.json = %+v", imported)
+			}
+		})
+	}
+
+	if err := os.Symlink("/home/user/.ssh", filepath.Join(rp.BasePath, "nix", "var", "ssh")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ProfileExport(context.TODO(), "work", filepath.Join(tmp, "outside.tar.gz"), true, nil); err == nil {
+		t.Errorf("ProfileExport() must fail on a symlink out of nix store, instead of dropping it")
+	}
+
+	if _, err := ProfileImport(context.TODO(), filepath.Join(tmp, "teammate.tar.gz"), "teammate"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("ProfileImport() must not overwrite an existing profile, got err = %v", err)
+	}
+}
+
+func TestExtractTar_RejectsEscapes(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tar.Header
+	}{
+		{
+			name:    "parent dir",
+			entries: []tar.Header{{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0o644}},
+		},
+		{
+			name:    "absolute path",
+			entries: []tar.Header{{Name: "/etc/evil", Typeflag: tar.TypeReg, Mode: 0o644}},
+		},
+		{
+			name: "through a symlink",
+			entries: []tar.Header{
+				{Name: "nix/store/link", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+				{Name: "nix/store/link/evil", Typeflag: tar.TypeReg, Mode: 0o644},
+			},
+		},
+		{
+			name: "dir entry over a symlink",
+			entries: []tar.Header{
+				{Name: "nix/store/x", Typeflag: tar.TypeSymlink, Linkname: "../.."},
+				{Name: "nix/store/x/", Typeflag: tar.TypeDir, Mode: 0o777},
+			},
+		},
+		{
+			name:    "profile.json as a symlink",
+			entries: []tar.Header{{Name: "profile.json", Typeflag: tar.TypeSymlink, Linkname: "/home/user/.config/app/settings.json"}},
+		},
+		{
+			name:    "symlink in fake-home",
+			entries: []tar.Header{{Name: "fake-home/.gitconfig", Typeflag: tar.TypeSymlink, Linkname: "/home/user/.gitconfig"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			tw := tar.NewWriter(buf)
+			for i := range tt.entries {
+				if err := tw.WriteHeader(&tt.entries[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := extractTar(tar.NewReader(buf), t.TempDir()); err == nil {
+				t.Errorf("extractTar() must reject archive with %s", tt.name)
+			}
+		})
+	}
+}
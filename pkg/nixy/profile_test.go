@@ -0,0 +1,114 @@
+package nixy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfileRenameAndShow(t *testing.T) {
+	oldBase := profileBasePath
+	profileBasePath = filepath.Join(t.TempDir(), "profiles")
+	t.Cleanup(func() { profileBasePath = oldBase })
+
+	p := Profile{
+		Name:                "work",
+		NixPkgsCommitHash:   "abc123",
+		ProfilePath:         profilePath("work"),
+		ProfileNixyYAMLPath: filepath.Join(profilePath("work"), "nixy.yml"),
+	}
+
+	// INFO: nix store dirs are read only
+	storeDir := filepath.Join(p.ProfilePath, "nix", "store", "xyz-hello")
+	if err := os.MkdirAll(storeDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(storeDir, "hello"), []byte("hello world"), 0o444); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(storeDir, 0o555); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(p.ProfilePath, "workspaces", "ws-1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p.ProfileNixyYAMLPath, []byte("packages:\n  - which\n  - ncurses\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ProfileRename(context.TODO(), "work", "default"); err != nil {
+		t.Fatalf("ProfileRename() error = %v", err)
+	}
+
+	if err := ProfileRename(context.TODO(), "default", "../escape"); err == nil {
+		t.Errorf("ProfileRename() must reject invalid profile names")
+	}
+
+	renamed, err := GetProfile(nil, "default")
+	if err != nil {
+		t.Fatalf("GetProfile() error = %v", err)
+	}
+	if renamed.Name != "default" || renamed.ProfilePath != profilePath("default") || renamed.ProfileNixyYAMLPath != filepath.Join(profilePath("default"), "nixy.yml") {
+		t.Errorf("profile.json not updated on rename, got %+v", renamed)
+	}
+
+	details, err := ProfileShow(context.TODO(), "default")
+	if err != nil {
+		t.Fatalf("ProfileShow() error = %v", err)
+	}
+
+	if details.NixPkgsCommitHash != "abc123" || details.WorkspaceCount != 1 || details.NixStoreDiskUsage != int64(len("hello world")) {
+		t.Errorf("ProfileShow() = %+v", details)
+	}
+	if len(details.Packages) != 2 || details.Packages[0] != "which" || details.Packages[1] != "ncurses" {
+		t.Errorf("ProfileShow().Packages = %v, want [which ncurses]", details.Packages)
+	}
+
+	if err := forceRemoveAll(profilePath("default")); err != nil {
+		t.Fatalf("forceRemoveAll() error = %v", err)
+	}
+	if exists(profilePath("default")) {
+		t.Errorf("forceRemoveAll() must remove read only nix store dirs too")
+	}
+}
+
+func TestHumanizeBytes(t *testing.T) {
+	tests := map[int64]string{
+		512:                    "512 B",
+		1536:                   "1.5 KiB",
+		5 * 1024 * 1024 * 1024: "5.0 GiB",
+	}
+
+	for n, want := range tests {
+		if got := HumanizeBytes(n); got != want {
+			t.Errorf("HumanizeBytes(%d) = %s, want %s", n, got, want)
+		}
+	}
+}
+
+func TestProfileRemove_InvalidName(t *testing.T) {
+	oldBase := profileBasePath
+	profileBasePath = filepath.Join(t.TempDir(), "profiles")
+	t.Cleanup(func() { profileBasePath = oldBase })
+
+	if err := os.MkdirAll(profilePath("work"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// INFO: even with --yes, these must never resolve to the profiles dir (or the nixy data dir)
+	ctx := WithPromptOptions(context.TODO(), PromptOptions{AssumeYes: true})
+	for _, name := range []string{"..", ".", "", "../profiles", "work/.."} {
+		if err := ProfileRemove(ctx, name); err == nil {
+			t.Errorf("ProfileRemove(%q) must fail", name)
+		}
+	}
+
+	if !exists(profilePath("work")) {
+		t.Errorf("profiles must not be removed")
+	}
+}
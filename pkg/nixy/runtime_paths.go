@@ -20,7 +20,7 @@ type RuntimePaths struct {
 // NewRuntimePaths creates and initializes the runtime paths for a given profile name.
 // This is always called regardless of NIXY_USE_PROFILE setting.
 func NewRuntimePaths(name string) (*RuntimePaths, error) {
-	basePath := filepath.Join(XDGDataDir(), "profiles", name)
+	basePath := profilePath(name)
 	nixDir := filepath.Join(basePath, "nix")
 	fakeHomeDir := filepath.Join(basePath, "fake-home")
 
@@ -0,0 +1,166 @@
+package nixy
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// jsonSchema is the subset of JSON Schema (draft-07), that is needed to describe nixy.yml
+type jsonSchema struct {
+	Schema      string `json:"$schema,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties any                    `json:"additionalProperties,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	OneOf                []*jsonSchema          `json:"oneOf,omitempty"`
+}
+
+// schemaOverride describes the types, whose yaml representation differs from their go shape
+func schemaOverride(t reflect.Type) *jsonSchema {
+	switch t {
+	case reflect.TypeFor[NixPkgsMap]():
+		return &jsonSchema{
+			Type:                 "object",
+			Description:          "nixpkgs commits, keyed by name. Packages refer to them as <name>#<package>",
+			AdditionalProperties: &jsonSchema{Type: "string"},
+			Required:             []string{"default"},
+		}
+	case reflect.TypeFor[NormalizedPackage]():
+		return &jsonSchema{
+			OneOf: []*jsonSchema{
+				{Type: "string", Description: "nix package, as <package> or <nixpkgs-key>#<package>"},
+				schemaForType(reflect.TypeFor[URLPackage]()),
+				schemaForType(reflect.TypeFor[platformNixPackage]()),
+			},
+		}
+	case reflect.TypeFor[Script]():
+		return &jsonSchema{
+			OneOf: []*jsonSchema{
+				{Type: "string", Description: "bash command to run"},
+				schemaForStruct(t),
+			},
+		}
+	default:
+		return nil
+	}
+}
+
+// JSONSchema generates JSON Schema for nixy.yml from the Nixy go types,
+// so that editors can autocomplete and validate it (e.g. with yaml-language-server)
+func JSONSchema() ([]byte, error) {
+	schema := schemaForType(reflect.TypeFor[Nixy]())
+	schema.Schema = "http://json-schema.org/draft-07/schema#"
+	schema.Title = "nixy.yml"
+	schema.Description = "nixy project development workspace configuration"
+
+	b := new(bytes.Buffer)
+	encoder := json.NewEncoder(b)
+	encoder.SetIndent("", "  ")
+	// INFO: descriptions contain <placeholders>, which must not be escaped
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(schema); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func schemaForType(t reflect.Type) *jsonSchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if schema := schemaOverride(t); schema != nil {
+		return schema
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &jsonSchema{Type: "array", Items: schemaForType(t.Elem())}
+	case reflect.Map:
+		return &jsonSchema{Type: "object", AdditionalProperties: schemaForType(t.Elem())}
+	case reflect.Struct:
+		return schemaForStruct(t)
+	default:
+		// INFO: any other type could be anything in yaml
+		return &jsonSchema{}
+	}
+}
+
+func schemaForStruct(t reflect.Type) *jsonSchema {
+	schema := &jsonSchema{
+		Type:                 "object",
+		Properties:           map[string]*jsonSchema{},
+		AdditionalProperties: false,
+	}
+
+	for _, field := range yamlFields(t) {
+		schema.Properties[field.name] = schemaForType(field.Type)
+		if field.required {
+			schema.Required = append(schema.Required, field.name)
+		}
+	}
+
+	return schema
+}
+
+type yamlField struct {
+	reflect.StructField
+	name     string
+	required bool
+}
+
+// yamlFields lists exported fields of a struct, along with their yaml key names.
+// Fields tagged with `jsonschema:"required"` are marked as required.
+func yamlFields(t reflect.Type) []yamlField {
+	fields := make([]yamlField, 0, t.NumField())
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		fields = append(fields, yamlField{
+			StructField: field,
+			name:        name,
+			required:    slices.Contains(strings.Split(field.Tag.Get("jsonschema"), ","), "required"),
+		})
+	}
+
+	return fields
+}
+
+// yamlFieldNames returns the yaml key names of a struct's fields
+func yamlFieldNames(t reflect.Type) []string {
+	fields := yamlFields(t)
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		names = append(names, f.name)
+	}
+	return names
+}
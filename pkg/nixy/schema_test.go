@@ -0,0 +1,65 @@
+package nixy
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestJSONSchema(t *testing.T) {
+	b, err := JSONSchema()
+	if err != nil {
+		t.Fatalf("failed to generate schema: %v", err)
+	}
+
+	var schema jsonSchema
+	if err := json.Unmarshal(b, &schema); err != nil {
+		t.Fatalf("failed to parse generated schema: %v", err)
+	}
+
+	if schema.AdditionalProperties != false {
+		t.Errorf("top level must not allow additional properties, got: %v", schema.AdditionalProperties)
+	}
+
+	if !slices.Contains(schema.Required, "nixpkgs") {
+		t.Errorf("nixpkgs must be required, got: %v", schema.Required)
+	}
+
+	for _, key := range []string{"nixpkgs", "packages", "libraries", "env", "onShellEnter", "onShellExit", "builds", "mounts"} {
+		if _, ok := schema.Properties[key]; !ok {
+			t.Errorf("missing property %q", key)
+		}
+	}
+
+	packages := schema.Properties["packages"]
+	if packages.Type != "array" || packages.Items == nil {
+		t.Fatalf("packages must be an array, got: %+v", packages)
+	}
+
+	oneOf := packages.Items.OneOf
+	if len(oneOf) != 3 {
+		t.Fatalf("package must be oneOf string, URL package or platform specific package, got: %+v", oneOf)
+	}
+
+	if oneOf[0].Type != "string" {
+		t.Errorf("first variant must be a string, got: %q", oneOf[0].Type)
+	}
+
+	urlPackage := oneOf[1]
+	if _, ok := urlPackage.Properties["sources"]; !ok {
+		t.Errorf("URL package must have sources, got: %+v", urlPackage.Properties)
+	}
+
+	if !slices.Equal(urlPackage.Required, []string{"name", "sources"}) {
+		t.Errorf("URL package must require name and sources, got: %v", urlPackage.Required)
+	}
+
+	if platformPackage := oneOf[2]; !slices.Equal(platformPackage.Required, []string{"nix"}) {
+		t.Errorf("platform specific package must require nix, got: %v", platformPackage.Required)
+	}
+
+	mount := schema.Properties["mounts"].Items
+	if !slices.Equal(mount.Required, []string{"source", "dest"}) {
+		t.Errorf("mount must require source and dest, got: %v", mount.Required)
+	}
+}
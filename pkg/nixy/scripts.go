@@ -0,0 +1,151 @@
+package nixy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Script is a project script, run with `nixy run <name>`.
+// In nixy.yml, it is either just the command, or a mapping with cmd, depends and description
+type Script struct {
+	Cmd         string   `yaml:"cmd" jsonschema:"required"`
+	Depends     []string `yaml:"depends,omitempty"`
+	Description string   `yaml:"description,omitempty"`
+}
+
+func (s *Script) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&s.Cmd)
+	}
+
+	type script Script
+	if err := value.Decode((*script)(s)); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(s.Cmd) == "" {
+		return fmt.Errorf("invalid script, must specify .cmd")
+	}
+
+	return nil
+}
+
+// scriptRunOrder returns the scripts to run for the given script, with its dependencies first
+func scriptRunOrder(scripts map[string]Script, name string) ([]string, error) {
+	order := make([]string, 0, 1)
+	done := make(map[string]bool, len(scripts))
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		if done[name] {
+			return nil
+		}
+
+		for i := range path {
+			if path[i] == name {
+				return fmt.Errorf("script dependency cycle detected: %s -> %s", strings.Join(path[i:], " -> "), name)
+			}
+		}
+
+		script, ok := scripts[name]
+		if !ok {
+			if len(path) > 0 {
+				return fmt.Errorf("script %q depends on %q, which is not defined in scripts", path[len(path)-1], name)
+			}
+			return fmt.Errorf("script %q is not defined in scripts", name)
+		}
+
+		for _, dep := range script.Depends {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+
+		done[name] = true
+		order = append(order, name)
+		return nil
+	}
+
+	if err := visit(name, nil); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// scriptProgram renders a bash program, that runs the script after its dependencies,
+// each in a subshell, stopping at the first failure. args are appended to the script's command
+func scriptProgram(scripts map[string]Script, name string, args []string) (string, error) {
+	order, err := scriptRunOrder(scripts, name)
+	if err != nil {
+		return "", err
+	}
+
+	steps := make([]string, 0, len(order))
+	for _, item := range order {
+		cmd := strings.TrimRight(scripts[item].Cmd, "\n")
+		if item == name && len(args) > 0 {
+			cmd += " " + shellQuote(args...)
+		}
+		steps = append(steps, fmt.Sprintf("(\n%s\n)", cmd))
+	}
+
+	return strings.Join(steps, " &&\n"), nil
+}
+
+// shellQuote quotes each argument for bash, so that it is passed as is
+func shellQuote(args ...string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, "'"+strings.ReplaceAll(arg, "'", `'\''`)+"'")
+	}
+	return strings.Join(quoted, " ")
+}
+
+// LoadScripts returns the scripts defined in the nixy file (including its imports)
+func LoadScripts(ctx context.Context, file string) (map[string]Script, error) {
+	nc, err := parseAndSyncNixyFile(ctx, file)
+	if err != nil {
+		return nil, &ExitError{Code: ExitCodeConfig, Err: err}
+	}
+	return nc.Scripts, nil
+}
+
+// Run runs the script (along with its dependencies) inside the workspace environment, without an interactive shell
+func (n *NixyWrapper) Run(ctx *Context, name string, args []string) error {
+	program, err := scriptProgram(n.Scripts, name, args)
+	if err != nil {
+		return err
+	}
+
+	cmd, err := n.nixShellExec(ctx, program)
+	if err != nil {
+		return err
+	}
+
+	slog.Debug(fmt.Sprintf("[Run %s] Executing", name), "command", cmd.String())
+	return runProcess(cmd)
+}
+
+// Run runs the script (along with its dependencies), in the current nixy shell
+func (n *InShellNixy) Run(ctx context.Context, name string, args []string) error {
+	program, err := scriptProgram(n.Scripts, name, args)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "bash", "-c", program)
+	cmd.Dir = n.PWD
+	cmd.Stdout = os.Stdout
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+
+	slog.Debug(fmt.Sprintf("[Run %s] Executing", name), "command", cmd.String())
+	return runProcess(cmd)
+}
@@ -0,0 +1,131 @@
+package nixy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestScriptProgram(t *testing.T) {
+	var nc Nixy
+	if err := yaml.Unmarshal([]byte(`scripts:
+  gen: go generate ./...
+  build:
+    cmd: go build ./...
+    depends: [gen]
+  test:
+    cmd: go test ./...
+    depends: [gen, build]
+  loop-a:
+    cmd: echo a
+    depends: [loop-b]
+  loop-b:
+    cmd: echo b
+    depends: [loop-a]
+  broken:
+    cmd: echo broken
+    depends: [missing]
+`), &nc); err != nil {
+		t.Fatalf("failed to parse scripts: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		script  string
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "script without dependencies",
+			script: "gen",
+			want:   "(\ngo generate ./...\n)",
+		},
+		{
+			name:   "dependencies run first, and only once",
+			script: "test",
+			args:   []string{"-run", "Test Foo's"},
+			want:   "(\ngo generate ./...\n) &&\n(\ngo build ./...\n) &&\n(\ngo test ./... '-run' 'Test Foo'\\''s'\n)",
+		},
+		{
+			name:    "dependency cycle",
+			script:  "loop-a",
+			wantErr: "script dependency cycle detected: loop-a -> loop-b -> loop-a",
+		},
+		{
+			name:    "undefined dependency",
+			script:  "broken",
+			wantErr: `script "broken" depends on "missing", which is not defined in scripts`,
+		},
+		{
+			name:    "undefined script",
+			script:  "deploy",
+			wantErr: `script "deploy" is not defined in scripts`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scriptProgram(nc.Scripts, tt.script, tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error %q, got: %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("mismatch:\ngot:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// setLocalShellEnv sets the env, nixy shell (with local executor) has, for nixy commands run inside it
+func setLocalShellEnv(t *testing.T, file string) {
+	t.Helper()
+
+	ctx := &Context{Context: context.TODO(), NixyMode: LocalMode, PWD: filepath.Dir(file), NixyFile: file}
+	args := &ExecutorArgs{EnvVars: executorEnvVars{NixyWorkspaceDir: filepath.Dir(file)}}
+
+	for _, kv := range (&localExecutor{}).Environ(ctx, args) {
+		k, v, _ := strings.Cut(kv, "=")
+		t.Setenv(k, v)
+	}
+}
+
+func TestInShellNixy_Run_LocalExecutor(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "nixy.ci.yml")
+	out := filepath.Join(dir, "out")
+	if err := os.WriteFile(file, []byte("nixpkgs:\n  default: abc123\nscripts:\n  hello: echo hello > "+out+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	setLocalShellEnv(t, file)
+
+	n, err := LoadInNixyShell(context.TODO())
+	if err != nil {
+		t.Fatalf("LoadInNixyShell() error = %v", err)
+	}
+
+	if err := n.Run(context.TODO(), "hello", []string{"nixy"}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(b)); got != "hello nixy" {
+		t.Errorf("script output = %q, want %q", got, "hello nixy")
+	}
+}
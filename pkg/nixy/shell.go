@@ -1,14 +1,18 @@
 package nixy
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"log/slog"
 	"maps"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"slices"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/nxtcoder17/nixy/pkg/nixy/templates"
@@ -17,6 +21,9 @@ import (
 const (
 	shellHookFileName = "shell-hook.sh"
 	buildHookFileName = "build-hook.sh"
+
+	// shellExitFileName holds onShellExit, in the workspace flake dir
+	shellExitFileName = "shell-exit.sh"
 )
 
 // getProfilePackages returns profile packages if NIXY_USE_PROFILE is enabled
@@ -38,7 +45,7 @@ func (n *NixyWrapper) getProfilePackages(ctx *Context) []*NormalizedPackage {
 }
 
 // getProfileLibraries returns profile libraries if NIXY_USE_PROFILE is enabled
-func (n *NixyWrapper) getProfileLibraries(ctx *Context) []string {
+func (n *NixyWrapper) getProfileLibraries(ctx *Context) []*NormalizedPackage {
 	if !ctx.NixyUseProfile || n.profileNixy == nil {
 		return nil
 	}
@@ -50,11 +57,11 @@ func (n *NixyWrapper) getProfileEnvVars(ctx *Context) map[string]string {
 	if !ctx.NixyUseProfile || n.profileNixy == nil {
 		return nil
 	}
-	return n.profileNixy.Env
+	return n.profileNixy.envForPlatform(getOSArch())
 }
 
 func (nix *NixyWrapper) writeWorkspaceFlake(
-	ctx *Context, extraPackages []*NormalizedPackage, extraLibraries []string, env map[string]string,
+	ctx *Context, extraPackages []*NormalizedPackage, extraLibraries []*NormalizedPackage, env map[string]string, shells map[string]ShellVariant,
 ) error {
 	if !nix.hasHashChanged {
 		slog.Debug("nixy.yml hash has not changed, skipped writing flake.nix")
@@ -65,9 +72,10 @@ func (nix *NixyWrapper) writeWorkspaceFlake(
 		NixPkgs:          nix.NixPkgs,
 		WorkspaceDirPath: ctx.PWD,
 		Packages:         []*NormalizedPackage{},
-		Libraries:        []string{},
+		Libraries:        []*NormalizedPackage{},
 		Builds:           map[string]Build{},
 		EnvVars:          env,
+		Lock:             nix.lock,
 	}
 
 	input.Packages = append(input.Packages, extraPackages...)
@@ -78,6 +86,15 @@ func (nix *NixyWrapper) writeWorkspaceFlake(
 
 	maps.Copy(input.Builds, nix.Builds)
 
+	overlays, err := copyOverlays(nix.executorArgs.WorkspaceFlakeDirHostPath, nix.Overlays)
+	if err != nil {
+		return err
+	}
+	input.Overlays = overlays
+	input.NixpkgsConfig = nix.NixpkgsConfig
+	input.ExtraPackagesExpr = nix.ExtraPackagesExpr
+	input.Shells = shells
+
 	flakeParams, err := genWorkspaceFlakeParams(input)
 	if err != nil {
 		return err
@@ -90,11 +107,39 @@ func (nix *NixyWrapper) writeWorkspaceFlake(
 		return err
 	}
 
+	if err := os.WriteFile(filepath.Join(nix.executorArgs.WorkspaceFlakeDirHostPath, shellExitFileName), []byte(nix.OnShellExit), 0o744); err != nil {
+		return fmt.Errorf("failed to write %s: %w", shellExitFileName, err)
+	}
+
 	slog.Debug("writing shell-hook.sh")
 	if err := os.WriteFile(filepath.Join(nix.executorArgs.WorkspaceFlakeDirHostPath, "shell-hook.sh"), []byte(shellHook), 0o744); err != nil {
 		return fmt.Errorf("failed to write shell-hook.sh: %w", err)
 	}
 
+	for name, shell := range shells {
+		shellHook, err := templates.RenderShellHook(templates.ShellHookParams{
+			OnShellEnter: joinScripts(nix.OnShellEnter, shell.OnShellEnter),
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(filepath.Join(nix.executorArgs.WorkspaceFlakeDirHostPath, shellHookFile(name)), []byte(shellHook), 0o744); err != nil {
+			return fmt.Errorf("failed to write %s: %w", shellHookFile(name), err)
+		}
+	}
+
+	// INFO: shell-init files are cached per shell variant, and must be regenerated against the new flake.nix
+	staleShellInits, err := filepath.Glob(filepath.Join(nix.executorArgs.WorkspaceFlakeDirHostPath, "shell-init*.sh"))
+	if err != nil {
+		return err
+	}
+	for _, f := range staleShellInits {
+		if err := os.Remove(f); err != nil {
+			return fmt.Errorf("failed to remove stale %s: %w", filepath.Base(f), err)
+		}
+	}
+
 	flake, err := templates.RenderWorkspaceFlake(flakeParams)
 	if err != nil {
 		return fmt.Errorf("failed to render flake.nix: %w", err)
@@ -104,45 +149,120 @@ func (nix *NixyWrapper) writeWorkspaceFlake(
 	return os.WriteFile(filepath.Join(nix.executorArgs.WorkspaceFlakeDirHostPath, "flake.nix"), flake, 0o644)
 }
 
-func (n *NixyWrapper) nixShellExec(ctx *Context, program string) (*exec.Cmd, error) {
+// expandUserEnv expands env vars referenced in user defined env values, where $$ escapes a literal $
+func expandUserEnv(env map[string]string, executorEnv map[string]string) map[string]string {
+	result := make(map[string]string, len(env))
+	for k, v := range env {
+		expanded := os.Expand(
+			strings.ReplaceAll(v, "$$", "__DOLLOR_ESCAPE__"), func(s string) string {
+				if v, ok := executorEnv[s]; ok {
+					return v
+				}
+				return os.Getenv(s)
+			},
+		)
+		result[k] = strings.ReplaceAll(expanded, "__DOLLOR_ESCAPE__", "$")
+	}
+	return result
+}
+
+func devShellName(variant string) string {
+	if variant == "" {
+		return "default"
+	}
+	return variant
+}
+
+// shellHookFile is the onShellEnter script of a shell variant, inside workspace flake dir
+func shellHookFile(variant string) string {
+	if variant == "" {
+		return shellHookFileName
+	}
+	return fmt.Sprintf("shell-hook-%s.sh", variant)
+}
+
+// shellInitFile is the cached output of `nix print-dev-env` for a shell variant, inside workspace flake dir
+func shellInitFile(variant string) string {
+	if variant == "" {
+		return "shell-init.sh"
+	}
+	return fmt.Sprintf("shell-init-%s.sh", variant)
+}
+
+// printDevEnv evaluates the workspace flake (`nix print-dev-env`) for the shell variant, into shellInit file (inside workspace flake dir).
+// It runs on its own, before the user's command, so that a failure is reported as nixy's own (ExitCodeFlakeEval)
+func (n *NixyWrapper) printDevEnv(ctx *Context, shellInit string) error {
+	// INFO: shell-init files are removed, whenever nixy.yml changes. So, they are (re)generated on demand, per shell variant
+	hostFile := filepath.Join(n.executorArgs.WorkspaceFlakeDirHostPath, shellInit)
+	if exists(hostFile) {
+		return nil
+	}
+
+	// [READ about nix print-dev-env](https://nix.dev/manual/nix/2.18/command-ref/new-cli/nix3-print-dev-env)
+	flakeRef := fmt.Sprintf("%s#%s", n.executorArgs.WorkspaceFlakeDirMountedPath, devShellName(ctx.ShellVariant))
+	cmd, err := n.prepareCommand(ctx, false, n.executorArgs.NixBinaryMountedPath, "print-dev-env", flakeRef)
+	if err != nil {
+		return err
+	}
+	cmd.Env = append(cmd.Env, n.executor.Environ(ctx, n.executorArgs)...)
+
+	stdout := new(bytes.Buffer)
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+
+	slog.Debug("Evaluating workspace flake", "command", cmd.String())
+	if err := cmd.Run(); err != nil {
+		return &ExitError{Code: ExitCodeFlakeEval, Err: fmt.Errorf("failed to evaluate workspace flake (%s): %w", flakeRef, err)}
+	}
+
+	if err := os.WriteFile(hostFile+".tmp", stdout.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(hostFile+".tmp", hostFile)
+}
+
+// nixShellExec prepares the command, that runs program (a bash snippet) inside the workspace environment.
+// When argv is provided, it is exec'd as positional args of that bash, so that every argument is preserved as is
+func (n *NixyWrapper) nixShellExec(ctx *Context, program string, argv ...string) (*exec.Cmd, error) {
 	// Extract profile-related data (only when NIXY_USE_PROFILE is enabled)
 	profilePackages := n.getProfilePackages(ctx)
 	profileLibs := n.getProfileLibraries(ctx)
 	profileEnvVars := n.getProfileEnvVars(ctx)
 
-	if program == "" {
-		if v, ok := os.LookupEnv("SHELL"); ok {
-			program = filepath.Base(v)
-		} else {
-			program = "bash"
-		}
+	if program == "" && len(argv) == 0 {
+		program = defaultShellProgram()
 	}
 
 	executorEnv := n.executorArgs.EnvVars.toMap(ctx)
 
-	userEnv := make(map[string]string, len(profileEnvVars)+len(n.Env))
+	env := n.envForPlatform(getOSArch())
+
+	userEnv := make(map[string]string, len(profileEnvVars)+len(env))
 	maps.Copy(userEnv, profileEnvVars)
-	maps.Copy(userEnv, n.Env)
+	maps.Copy(userEnv, env)
+
+	shells := make(map[string]ShellVariant, len(n.Shells))
+	for name, shell := range n.Shells {
+		shellEnv := maps.Clone(userEnv)
+		maps.Copy(shellEnv, shell.Env)
+		shell.Env = expandUserEnv(shellEnv, executorEnv)
+		shells[name] = shell
+	}
 
-	keys := make([]string, 0, len(userEnv))
-	for k := range userEnv {
-		keys = append(keys, k)
+	userEnv = expandUserEnv(userEnv, executorEnv)
+
+	if ctx.ShellVariant != "" {
+		if _, ok := n.Shells[ctx.ShellVariant]; !ok {
+			return nil, fmt.Errorf("shell variant %q is not defined in nixy.yml (available: %s)", ctx.ShellVariant, strings.Join(slices.Sorted(maps.Keys(n.Shells)), ", "))
+		}
 	}
-	slices.Sort(keys)
 
-	for k := range userEnv {
-		expanded := os.Expand(
-			strings.ReplaceAll(userEnv[k], "$$", "__DOLLOR_ESCAPE__"), func(s string) string {
-				if v, ok := executorEnv[s]; ok {
-					return v
-				}
-				return os.Getenv(s)
-			},
-		)
-		userEnv[k] = strings.ReplaceAll(expanded, "__DOLLOR_ESCAPE__", "$")
+	if err := n.writeWorkspaceFlake(ctx, profilePackages, profileLibs, userEnv, shells); err != nil {
+		return nil, err
 	}
 
-	if err := n.writeWorkspaceFlake(ctx, profilePackages, profileLibs, userEnv); err != nil {
+	shellInit := shellInitFile(ctx.ShellVariant)
+	if err := n.printDevEnv(ctx, shellInit); err != nil {
 		return nil, err
 	}
 
@@ -150,16 +270,13 @@ func (n *NixyWrapper) nixShellExec(ctx *Context, program string) (*exec.Cmd, err
 		fmt.Sprintf("cd %s", n.executorArgs.WorkspaceFlakeDirMountedPath),
 	}
 
-	if n.hasHashChanged {
-		scripts = append(scripts,
-			// [READ about nix print-dev-env](https://nix.dev/manual/nix/2.18/command-ref/new-cli/nix3-print-dev-env)
-			"nix print-dev-env . > shell-init.sh",
-		)
+	scripts = append(scripts, fmt.Sprintf("source %s", shellInit))
+	if len(argv) > 0 {
+		scripts = append(scripts, `exec "$@"`)
+	} else {
+		scripts = append(scripts, program)
 	}
 
-	scripts = append(scripts, "source shell-init.sh")
-	scripts = append(scripts, program)
-
 	nixShell := []string{"shell"}
 
 	nixShell = append(nixShell,
@@ -170,17 +287,18 @@ func (n *NixyWrapper) nixShellExec(ctx *Context, program string) (*exec.Cmd, err
 		strings.Join(scripts, "\n"),
 	)
 
+	if len(argv) > 0 {
+		// INFO: first arg after the script is $0
+		nixShell = append(nixShell, "nixy")
+		nixShell = append(nixShell, argv...)
+	}
+
 	cmd, err := n.PrepareShellCommand(ctx, n.executorArgs.NixBinaryMountedPath, nixShell...)
 	if err != nil {
 		return nil, err
 	}
 
-	if ctx.NixyMode == LocalMode {
-		cmd.Env = append(cmd.Env, "NIXY_SHELL=true")
-		cmd.Env = append(cmd.Env, os.Environ()...)
-	} else {
-		cmd.Env = append(cmd.Env, n.executorArgs.EnvVars.ToEnviron(ctx)...)
-	}
+	cmd.Env = append(cmd.Env, n.executor.Environ(ctx, n.executorArgs)...)
 
 	cmd.Stdout = os.Stdout
 	cmd.Stdin = os.Stdin
@@ -189,21 +307,82 @@ func (n *NixyWrapper) nixShellExec(ctx *Context, program string) (*exec.Cmd, err
 	return cmd, nil
 }
 
+// withShellExitHook wraps program, so that hookFile (onShellExit) runs when program exits (even on SIGHUP).
+// hook's failure is reported, but the exit code is always program's
+func withShellExitHook(program string, hookFile string) string {
+	return strings.Join([]string{
+		"__nixy_shell_exit() {",
+		"  __nixy_exit_code=$?",
+		"  trap - EXIT",
+		fmt.Sprintf("  if [ -s %[1]s ]; then ( source %[1]s ) || echo \"[nixy] onShellExit failed with exit code $?\" >&2; fi", hookFile),
+		"  exit $__nixy_exit_code",
+		"}",
+		"trap __nixy_shell_exit EXIT",
+		// INFO: exits (running the EXIT trap), instead of dying on SIGHUP
+		"trap 'exit 129' HUP",
+		program,
+	}, "\n")
+}
+
 func (n *NixyWrapper) Shell(ctx *Context, program string) error {
 	start := time.Now()
+
+	if program == "" {
+		program = defaultShellProgram()
+	}
+	program = withShellExitHook(program, filepath.Join(n.executorArgs.WorkspaceFlakeDirMountedPath, shellExitFileName))
+
 	cmd, err := n.nixShellExec(ctx, program)
 	if err != nil {
 		return err
 	}
 
+	// INFO: on SIGHUP (e.g. terminal closed), nixy must live on, till the shell has run onShellExit and exited
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
 	slog.Debug("Executing", "command", cmd.String())
 	defer func() {
 		slog.Debug("Shell Exited", "in", fmt.Sprintf("%.2fs", time.Since(start).Seconds()))
 	}()
 
-	if err := cmd.Run(); err != nil {
+	return runProcess(cmd)
+}
+
+// Exec runs argv inside the workspace environment, passing through stdin, stdout and stderr
+func (n *NixyWrapper) Exec(ctx *Context, argv []string) error {
+	if len(argv) == 0 {
+		return fmt.Errorf("must specify a command to execute")
+	}
+
+	cmd, err := n.nixShellExec(ctx, "", argv...)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	slog.Debug("Executing", "command", cmd.String())
+	return runProcess(cmd)
+}
+
+// Exec runs argv, as nixy shell already has the workspace environment
+func (n *InShellNixy) Exec(ctx context.Context, argv []string) error {
+	if len(argv) == 0 {
+		return fmt.Errorf("must specify a command to execute")
+	}
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+
+	return runProcess(cmd)
+}
+
+// defaultShellProgram is the user's shell (as per $SHELL), or bash
+func defaultShellProgram() string {
+	if v, ok := os.LookupEnv("SHELL"); ok {
+		return filepath.Base(v)
+	}
+	return "bash"
 }
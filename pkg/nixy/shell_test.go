@@ -0,0 +1,201 @@
+package nixy
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNixShellExec_PreservesArgv(t *testing.T) {
+	dir := t.TempDir()
+	ctx := &Context{Context: context.TODO(), NixyMode: LocalMode, PWD: dir}
+
+	n := &NixyWrapper{
+		Context:  ctx,
+		executor: &localExecutor{},
+		executorArgs: &ExecutorArgs{
+			NixBinaryMountedPath:         "nix",
+			WorkspaceFlakeDirHostPath:    dir,
+			WorkspaceFlakeDirMountedPath: dir,
+		},
+		Nixy: &Nixy{NixPkgs: NixPkgsMap{"default": "abc123"}},
+	}
+
+	// INFO: workspace flake is already evaluated
+	if err := os.WriteFile(filepath.Join(dir, shellInitFile("")), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	argv := []string{"printf", "%s\n", "arg with spaces", `"quoted"`, "it's", "$HOME"}
+	cmd, err := n.nixShellExec(ctx, "", argv...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	i := slices.Index(cmd.Args, "-c")
+	if i == -1 || i+2 >= len(cmd.Args) {
+		t.Fatalf("expected bash -c <script> in command, got: %q", cmd.Args)
+	}
+
+	if script := cmd.Args[i+1]; !strings.HasSuffix(script, `exec "$@"`) {
+		t.Errorf("script must exec its positional args, got:\n%s", script)
+	}
+
+	if got := cmd.Args[i+2:]; !slices.Equal(got, append([]string{"nixy"}, argv...)) {
+		t.Errorf("argv must be passed as is, got: %q", got)
+	}
+}
+
+func TestWithShellExitHook(t *testing.T) {
+	tests := []struct {
+		name         string
+		program      string
+		onShellExit  string
+		wantExitCode int
+		wantStderr   string
+	}{
+		{
+			name:         "hook runs after a normal exit",
+			program:      "echo $PGDATA > /dev/null; exit 0",
+			onShellExit:  `echo "stopping postgres at $PGDATA" > "$OUT"`,
+			wantExitCode: 0,
+		},
+		{
+			name:         "shell's exit code is kept, even when hook fails",
+			program:      "exit 3",
+			onShellExit:  `echo "stopping postgres at $PGDATA" > "$OUT"; exit 7`,
+			wantExitCode: 3,
+			wantStderr:   "onShellExit failed with exit code 7",
+		},
+		{
+			name:         "hook runs on SIGHUP",
+			program:      "kill -HUP $$; sleep 5",
+			onShellExit:  `echo "stopping postgres at $PGDATA" > "$OUT"`,
+			wantExitCode: 129,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			hookFile := filepath.Join(dir, shellExitFileName)
+			if err := os.WriteFile(hookFile, []byte(tt.onShellExit), 0o744); err != nil {
+				t.Fatal(err)
+			}
+
+			out := filepath.Join(dir, "out")
+			// INFO: onShellEnter's env is set before the wrapped shell starts
+			cmd := exec.Command("bash", "-c", "PGDATA=/tmp/pg\n"+withShellExitHook(tt.program, hookFile))
+			cmd.Env = append(os.Environ(), "OUT="+out)
+			stderr := new(strings.Builder)
+			cmd.Stderr = stderr
+
+			err := runProcess(cmd)
+			if got := ExitCode(err); got != tt.wantExitCode {
+				t.Errorf("exit code = %d, want %d (err: %v)", got, tt.wantExitCode, err)
+			}
+
+			b, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatalf("onShellExit did not run: %v", err)
+			}
+			if got := strings.TrimSpace(string(b)); got != "stopping postgres at /tmp/pg" {
+				t.Errorf("onShellExit output = %q, it must run with onShellEnter's env", got)
+			}
+
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.wantStderr)
+			}
+		})
+	}
+}
+
+func TestLoadInNixyShell_UsesNixyFile(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"nixy.yml":    "nixpkgs:\n  default: abc123\nonShellEnter: echo nearest\n",
+		"nixy.ci.yml": "nixpkgs:\n  default: abc123\nonShellEnter: echo ci\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("NIXY_WORKSPACE_DIR", dir)
+
+	t.Setenv("NIXY_FILE", "")
+	n, err := LoadInNixyShell(context.TODO())
+	if err != nil {
+		t.Fatalf("LoadInNixyShell() error = %v", err)
+	}
+	if n.OnShellEnter != "echo nearest" {
+		t.Errorf("without NIXY_FILE, nixy.yml in NIXY_WORKSPACE_DIR must be used, got onShellEnter %q", n.OnShellEnter)
+	}
+
+	t.Setenv("NIXY_FILE", filepath.Join(dir, "nixy.ci.yml"))
+	n, err = LoadInNixyShell(context.TODO())
+	if err != nil {
+		t.Fatalf("LoadInNixyShell() error = %v", err)
+	}
+	if n.OnShellEnter != "echo ci" {
+		t.Errorf("NIXY_FILE must be used, got onShellEnter %q", n.OnShellEnter)
+	}
+}
+
+func TestInShellNixy_Exec_LocalExecutor(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "nixy.ci.yml")
+	if err := os.WriteFile(file, []byte("nixpkgs:\n  default: abc123\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	setLocalShellEnv(t, file)
+
+	n, err := LoadInNixyShell(context.TODO())
+	if err != nil {
+		t.Fatalf("LoadInNixyShell() error = %v", err)
+	}
+
+	out := filepath.Join(dir, "out")
+	if err := n.Exec(context.TODO(), []string{"sh", "-c", `echo "$1" > "$2"`, "sh", "it's me", out}); err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(b)); got != "it's me" {
+		t.Errorf("command output = %q, want %q", got, "it's me")
+	}
+}
+
+func TestNixShellExec_FlakeEvalFailure(t *testing.T) {
+	dir := t.TempDir()
+	ctx := &Context{Context: context.TODO(), NixyMode: LocalMode, PWD: dir}
+
+	n := &NixyWrapper{
+		Context:  ctx,
+		executor: &localExecutor{},
+		executorArgs: &ExecutorArgs{
+			// INFO: stands in for a nix, which fails to evaluate the flake
+			NixBinaryMountedPath:         "false",
+			WorkspaceFlakeDirHostPath:    dir,
+			WorkspaceFlakeDirMountedPath: dir,
+		},
+		Nixy: &Nixy{NixPkgs: NixPkgsMap{"default": "abc123"}},
+	}
+
+	_, err := n.nixShellExec(ctx, "echo hi")
+	if IsProcessExit(err) || ExitCode(err) != ExitCodeFlakeEval {
+		t.Fatalf("flake eval failure must be nixy's own failure, with exit code %d, got: %v", ExitCodeFlakeEval, err)
+	}
+
+	if exists(filepath.Join(dir, shellInitFile(""))) {
+		t.Errorf("shell-init must not be written, when flake eval fails")
+	}
+}
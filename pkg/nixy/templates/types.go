@@ -81,9 +81,19 @@ type URLPackage struct {
 	BinPaths    []string `yaml:"-"`
 }
 
+// FlakeInput is a flake input, pinned to a revision.
+// When NarHash is set, nix verifies the fetched input against it.
+type FlakeInput struct {
+	Rev     string
+	NarHash string
+}
+
 type WorkspaceFlakeParams struct {
 	NixPkgsCommitsList []string
 	NixPkgsCommitsMap  map[string]string
+	NixPkgsNarHashMap  map[string]string
+
+	FlakeUtils FlakeInput
 
 	PackagesMap  map[string][]string
 	LibrariesMap map[string][]string
@@ -96,6 +106,22 @@ type WorkspaceFlakeParams struct {
 	OSArch string
 
 	EnvVars map[string]string
+
+	// NixpkgsConfig is a nix attrset, passed as config to every nixpkgs import
+	NixpkgsConfig string
+	Overlays      []string
+
+	ExtraPackagesExpr string
+
+	// Shells are the named shell variants, rendered as devShells.<name>
+	Shells map[string]DevShell
+}
+
+// DevShell is a shell variant, extending the default devShell
+type DevShell struct {
+	PackagesMap   map[string][]string
+	EnvVars       map[string]string
+	ShellHookFile string
 }
 
 type WorkspaceFlakePackgeBuild struct {
@@ -2,6 +2,7 @@
 
 {{- $nixpkgsList := .NixPkgsCommitsList }}
 {{- $nixpkgsMap := .NixPkgsCommitsMap }}
+{{- $nixpkgsNarHashes := .NixPkgsNarHashMap }}
 {{- $packagesMap := .PackagesMap }}
 {{- $librariesMap := .LibrariesMap }}
 {{- $urlPackages := .URLPackages }}
@@ -14,10 +15,10 @@
   description = "nixy project development workspace";
 
   inputs = {
-    flake-utils.url = "github:numtide/flake-utils/11707dc2f618dd54ca8739b309ec4fc024de578b";
+    flake-utils.url = "github:numtide/flake-utils/{{.FlakeUtils.Rev}}{{with .FlakeUtils.NarHash}}?narHash={{urlquery .}}{{end}}";
 
     {{- range $k := $nixpkgsList }}
-    nixpkgs_{{$k}}.url = "github:nixos/nixpkgs/{{index $nixpkgsMap $k}}";
+    nixpkgs_{{$k}}.url = "github:nixos/nixpkgs/{{index $nixpkgsMap $k}}{{with index $nixpkgsNarHashes $k}}?narHash={{urlquery .}}{{end}}";
     {{- end }}
   };
 
@@ -29,15 +30,22 @@
     }:
     flake-utils.lib.eachDefaultSystem (system:
       let
+        nixpkgsConfig = {{.NixpkgsConfig}};
+        overlays = [
+          {{- range $overlay := .Overlays }}
+          (import {{$overlay}})
+          {{- end }}
+        ];
+
         pkgs = import nixpkgs_{{$nixpkgsDefaultCommit}} {
-          inherit system;
-          config.allowUnfree = true;
+          inherit system overlays;
+          config = nixpkgsConfig;
         };
 
         {{ range $k := $nixpkgsList -}}
         pkgs_{{$k}} = import nixpkgs_{{$k}} {
-          inherit system;
-          config.allowUnfree = true;
+          inherit system overlays;
+          config = nixpkgsConfig;
         };
         {{- end }}
 
@@ -49,7 +57,9 @@
           pkgs_{{$k}}.{{$item}}
           {{- end }}
           {{- end }}
-        ] ++ (pkgs.lib.optionals pkgs.stdenv.isLinux [ pkgs.glibcLocales ]);
+        ]
+        {{- with .ExtraPackagesExpr }} ++ (with pkgs; {{.}}){{ end }}
+        ++ (pkgs.lib.optionals pkgs.stdenv.isLinux [ pkgs.glibcLocales ]);
 
         libraries = pkgs.lib.makeLibraryPath [
           {{- range $k := $nixpkgsList -}}
@@ -168,14 +178,9 @@
               "$BIN"
           '')
         ];
-      in
-      {
-        devShells.default = pkgs.mkShell {
-          # hardeningDisable = [ "all" ];
 
-          buildInputs = packages ++ urlPackages;
-
-          shellHook = ''
+        # shellHook shared by every devShell
+        commonShellHook = ''
             {{- /* INFO: because glibcLocales is a linux only package, and causes nixy shell to break on macos */}}
             ${
               if pkgs.stdenv.isLinux
@@ -205,7 +210,15 @@
             if [ -n "${libraries}" ]; then
               export LD_LIBRARY_PATH="${libraries}:$LD_LIBRARY_PATH"
             fi
+        '';
+      in
+      {
+        devShells.default = pkgs.mkShell {
+          # hardeningDisable = [ "all" ];
+
+          buildInputs = packages ++ urlPackages;
 
+          shellHook = commonShellHook + ''
             {{- range $k, $v := .EnvVars }}
             export {{$k}}="{{$v}}"
             {{- end }}
@@ -222,6 +235,33 @@
           '';
         };
 
+        {{- range $name, $shell := .Shells }}
+
+        devShells."{{$name}}" = pkgs.mkShell {
+          buildInputs = packages ++ urlPackages ++ [
+            {{- range $k := $nixpkgsList -}}
+            {{- range $item := index $shell.PackagesMap $k }}
+            pkgs_{{$k}}.{{$item}}
+            {{- end }}
+            {{- end }}
+          ];
+
+          shellHook = commonShellHook + ''
+            export NIXY_SHELL_VARIANT="{{$name}}"
+
+            {{- range $k, $v := $shell.EnvVars }}
+            export {{$k}}="{{$v}}"
+            {{- end }}
+
+            if [ -e {{$shell.ShellHookFile}} ]; then
+              source "{{$shell.ShellHookFile}}"
+            fi
+
+            cd {{$projectDir}}
+          '';
+        };
+        {{- end }}
+
         {{- range $name, $build := $builds }}
         packages.{{$name}} = let
             closure = pkgs.buildEnv {
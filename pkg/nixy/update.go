@@ -0,0 +1,96 @@
+package nixy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UpdateOptions configures how nixpkgs pins are updated
+type UpdateOptions struct {
+	// Keys are the nixpkgs keys to update, only the default key is updated when empty (unless All is set)
+	Keys []string
+
+	// All updates every nixpkgs key, as other keys (e.g. stable) are usually pinned on purpose
+	All bool
+
+	// Channel is the nixpkgs channel (or branch) to move the pins to, e.g. nixos-24.11
+	Channel string
+
+	// GitHubAPI is the base URL of GitHub API
+	GitHubAPI string
+}
+
+// NixpkgsUpdate describes a single nixpkgs pin that was moved
+type NixpkgsUpdate struct {
+	Key       string
+	OldCommit string
+	NewCommit string
+}
+
+// UpdateNixpkgs moves nixpkgs pins in the nixy file to the latest commit of a channel,
+// rewriting them in place to preserve user's comments and ordering
+func UpdateNixpkgs(ctx context.Context, file string, opts UpdateOptions) ([]NixpkgsUpdate, error) {
+	if opts.Channel == "" {
+		opts.Channel = DefaultNixpkgsChannel
+	}
+
+	if opts.GitHubAPI == "" {
+		opts.GitHubAPI = DefaultGitHubAPI
+	}
+
+	ef, err := openEditableNixyFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	nixpkgsNode := findMappingValue(ef.docNode, "nixpkgs")
+	if nixpkgsNode == nil || nixpkgsNode.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s must have nixpkgs, as a mapping of name to nixpkgs commit", file)
+	}
+
+	if opts.All && len(opts.Keys) > 0 {
+		return nil, fmt.Errorf("either update all nixpkgs keys, or the given ones (%s)", strings.Join(opts.Keys, ", "))
+	}
+
+	keys := opts.Keys
+	switch {
+	case opts.All:
+		keys = ef.cfg.NixPkgs.List()
+	case len(keys) == 0:
+		keys = []string{"default"}
+	}
+
+	for _, key := range keys {
+		if _, ok := ef.cfg.NixPkgs[key]; !ok {
+			return nil, fmt.Errorf("nixpkgs key %q is not defined in %s", key, file)
+		}
+	}
+
+	commit, err := fetchNixpkgsCommit(ctx, opts.GitHubAPI, opts.Channel)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make([]NixpkgsUpdate, 0, len(keys))
+	for _, key := range keys {
+		if ef.cfg.NixPkgs[key] == commit {
+			continue
+		}
+
+		setOrInsertScalarField(nixpkgsNode, key, commit, "")
+		updates = append(updates, NixpkgsUpdate{Key: key, OldCommit: ef.cfg.NixPkgs[key], NewCommit: commit})
+	}
+
+	if len(updates) == 0 {
+		return updates, nil
+	}
+
+	if err := ef.sync(); err != nil {
+		return nil, err
+	}
+
+	return updates, nil
+}
@@ -0,0 +1,139 @@
+package nixy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateNixpkgs(t *testing.T) {
+	channels := map[string]string{
+		"nixos-unstable": "unstable999",
+		"nixos-24.11":    "stable2411",
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for channel, sha := range channels {
+			if r.URL.Path == "/repos/nixos/nixpkgs/commits/"+channel {
+				fmt.Fprintf(w, `{"sha": %q}`, sha)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	input := `nixpkgs:
+  # pinned for go
+  default: abc123 # main
+  stable: def456
+packages:
+  - go
+`
+
+	tests := []struct {
+		name    string
+		opts    UpdateOptions
+		want    string
+		updates []NixpkgsUpdate
+		wantErr bool
+	}{
+		{
+			name: "updates only default key, when no keys are given",
+			opts: UpdateOptions{},
+			want: `nixpkgs:
+  # pinned for go
+  default: unstable999 # main
+  stable: def456
+packages:
+  - go
+`,
+			updates: []NixpkgsUpdate{
+				{Key: "default", OldCommit: "abc123", NewCommit: "unstable999"},
+			},
+		},
+		{
+			name: "updates all keys to nixos-unstable",
+			opts: UpdateOptions{All: true},
+			want: `nixpkgs:
+  # pinned for go
+  default: unstable999 # main
+  stable: unstable999
+packages:
+  - go
+`,
+			updates: []NixpkgsUpdate{
+				{Key: "default", OldCommit: "abc123", NewCommit: "unstable999"},
+				{Key: "stable", OldCommit: "def456", NewCommit: "unstable999"},
+			},
+		},
+		{
+			name: "updates selected key to a channel",
+			opts: UpdateOptions{Keys: []string{"stable"}, Channel: "nixos-24.11"},
+			want: `nixpkgs:
+  # pinned for go
+  default: abc123 # main
+  stable: stable2411
+packages:
+  - go
+`,
+			updates: []NixpkgsUpdate{
+				{Key: "stable", OldCommit: "def456", NewCommit: "stable2411"},
+			},
+		},
+		{
+			name:    "fails on undefined key",
+			opts:    UpdateOptions{Keys: []string{"unknown"}},
+			wantErr: true,
+		},
+		{
+			name:    "fails on both all and selected keys",
+			opts:    UpdateOptions{Keys: []string{"stable"}, All: true},
+			wantErr: true,
+		},
+		{
+			name:    "fails on unknown channel",
+			opts:    UpdateOptions{Channel: "nixos-00.00"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "nixy.yml")
+			if err := os.WriteFile(file, []byte(input), 0o644); err != nil {
+				t.Fatalf("failed to write nixy file: %v", err)
+			}
+
+			tt.opts.GitHubAPI = server.URL
+			updates, err := UpdateNixpkgs(context.TODO(), file, tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("wanted error, but got no error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if fmt.Sprint(updates) != fmt.Sprint(tt.updates) {
+				t.Errorf("updates mismatch:\ngot:  %v\nwant: %v", updates, tt.updates)
+			}
+
+			b, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("failed to read nixy file: %v", err)
+			}
+
+			if string(b) != tt.want {
+				t.Errorf("mismatch:\ngot:\n%s\nwant:\n%s", b, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,573 @@
+package nixy
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Diagnostic is a single problem found in a nixy.yml, along with its position
+type Diagnostic struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+}
+
+// nixyTopLevelKeys lists all the keys that are understood at the top level of a nixy.yml
+var nixyTopLevelKeys = yamlFieldNames(reflect.TypeFor[Nixy]())
+
+// Validate parses the nixy file at the given path, and reports every problem found in it.
+// An error is returned only when the file could not be read or parsed at all.
+func Validate(file string) ([]Diagnostic, error) {
+	_, rootNode, err := readNixyNode(file)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &validator{file: file, baseDir: filepath.Dir(file)}
+	v.validate(rootNode)
+
+	slices.SortStableFunc(v.diagnostics, func(a, b Diagnostic) int {
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+
+	return v.diagnostics, nil
+}
+
+type validator struct {
+	file        string
+	baseDir     string
+	nixpkgsKeys []string
+	diagnostics []Diagnostic
+}
+
+func (v *validator) report(node *yaml.Node, format string, args ...any) {
+	v.diagnostics = append(v.diagnostics, Diagnostic{
+		File:    v.file,
+		Line:    node.Line,
+		Column:  node.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) validate(root *yaml.Node) {
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		v.report(root, "nixy file is empty")
+		return
+	}
+
+	docNode := root.Content[0]
+	if docNode.Kind != yaml.MappingNode {
+		v.report(docNode, "expected a mapping at the top level")
+		return
+	}
+
+	for i := 0; i < len(docNode.Content)-1; i += 2 {
+		key := docNode.Content[i]
+		if slices.Contains(nixyTopLevelKeys, key.Value) {
+			continue
+		}
+
+		if suggestion := closestKey(key.Value, nixyTopLevelKeys); suggestion != "" {
+			v.report(key, "unknown key %q, did you mean %q ?", key.Value, suggestion)
+			continue
+		}
+		v.report(key, "unknown key %q", key.Value)
+	}
+
+	if node := findMappingValue(docNode, "imports"); node != nil {
+		v.validateImports(node)
+	}
+
+	// INFO: nixpkgs must be validated first, as packages, libraries and builds refer to its keys
+	v.validateNixPkgs(docNode)
+
+	if node := findMappingValue(docNode, "packages"); node != nil {
+		v.validatePackages(node)
+	}
+
+	if node := findMappingValue(docNode, "libraries"); node != nil {
+		v.validateLibraries(node)
+	}
+
+	if node := findMappingValue(docNode, "platformEnv"); node != nil {
+		v.validatePlatformEnv(node)
+	}
+
+	if node := findMappingValue(docNode, "builds"); node != nil {
+		v.validateBuilds(node)
+	}
+
+	if node := findMappingValue(docNode, "mounts"); node != nil {
+		v.validateMounts(node)
+	}
+
+	if node := findMappingValue(docNode, "scripts"); node != nil {
+		v.validateScripts(node)
+	}
+
+	if node := findMappingValue(docNode, "shells"); node != nil {
+		v.validateShells(node)
+	}
+
+	if node := findMappingValue(docNode, "overlays"); node != nil {
+		v.validateOverlays(node)
+	}
+
+	if node := findMappingValue(docNode, "nixpkgsConfig"); node != nil && node.Kind != yaml.MappingNode {
+		v.report(node, "nixpkgsConfig must be a mapping of nixpkgs config options")
+	}
+}
+
+func (v *validator) validateImports(node *yaml.Node) {
+	if node.Kind != yaml.SequenceNode {
+		v.report(node, "imports must be a list of nixy files")
+		return
+	}
+
+	for _, item := range node.Content {
+		if item.Kind != yaml.ScalarNode || item.Value == "" {
+			v.report(item, "import must be a path to a nixy file")
+			continue
+		}
+
+		importFile := resolveImportPath(v.file, item.Value)
+		if _, err := os.Stat(importFile); err != nil {
+			v.report(item, "imported file %q does not exist", item.Value)
+			continue
+		}
+
+		v.nixpkgsKeys = append(v.nixpkgsKeys, importedNixPkgsKeys(importFile, map[string]bool{v.file: true})...)
+	}
+}
+
+// importedNixPkgsKeys lists the nixpkgs keys defined in an imported file, and its own imports
+func importedNixPkgsKeys(file string, visited map[string]bool) []string {
+	if visited[file] {
+		return nil
+	}
+	visited[file] = true
+
+	_, rootNode, err := readNixyNode(file)
+	if err != nil {
+		return nil
+	}
+
+	var nc Nixy
+	if err := rootNode.Decode(&nc); err != nil {
+		return nil
+	}
+
+	keys := slices.Collect(maps.Keys(nc.NixPkgs))
+	for _, imp := range nc.Imports {
+		keys = append(keys, importedNixPkgsKeys(resolveImportPath(file, imp), visited)...)
+	}
+	return keys
+}
+
+func (v *validator) validateNixPkgs(docNode *yaml.Node) {
+	node := findMappingValue(docNode, "nixpkgs")
+	if node == nil {
+		if slices.Contains(v.nixpkgsKeys, "default") {
+			// INFO: nixpkgs comes from an imported file
+			return
+		}
+		v.report(docNode, "missing nixpkgs, it must have a default key containing a nixpkgs hash")
+		return
+	}
+
+	if node.Kind != yaml.MappingNode {
+		v.report(node, "nixpkgs must be a mapping of name to nixpkgs commit")
+		return
+	}
+
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		v.nixpkgsKeys = append(v.nixpkgsKeys, key.Value)
+		if value.Kind != yaml.ScalarNode || value.Value == "" {
+			v.report(value, "nixpkgs.%s must be a nixpkgs commit", key.Value)
+		}
+	}
+
+	if !slices.Contains(v.nixpkgsKeys, "default") {
+		v.report(node, "nixpkgs must have a default key, containing a nixpkgs hash")
+	}
+}
+
+// validateNixPackageRef checks that a `key#pkg` reference uses a defined nixpkgs key
+func (v *validator) validateNixPackageRef(node *yaml.Node, kind string) {
+	if node.Kind != yaml.ScalarNode {
+		v.report(node, "%s must be a string", kind)
+		return
+	}
+
+	np, err := parseNixPackage(node.Value)
+	if err != nil {
+		v.report(node, "invalid %s: %s", kind, err)
+		return
+	}
+
+	if np.NixPackage.Commit != "" && !slices.Contains(v.nixpkgsKeys, np.NixPackage.Commit) {
+		v.report(node, "%s %q refers to nixpkgs key %q, which is not defined in nixpkgs", kind, node.Value, np.NixPackage.Commit)
+	}
+}
+
+func (v *validator) validatePackages(node *yaml.Node) {
+	if node.Kind != yaml.SequenceNode {
+		v.report(node, "packages must be a list")
+		return
+	}
+
+	for _, item := range node.Content {
+		switch item.Kind {
+		case yaml.ScalarNode:
+			v.validateNixPackageRef(item, "package")
+		case yaml.MappingNode:
+			if findMappingValue(item, "nix") != nil {
+				v.validatePlatformPackage(item, "package")
+				continue
+			}
+			v.validateURLPackage(item)
+		default:
+			v.report(item, "package must either be a string, a platform specific package, or a URL package")
+		}
+	}
+}
+
+func (v *validator) validateURLPackage(node *yaml.Node) {
+	name := findMappingValue(node, "name")
+	if name == nil || name.Value == "" {
+		v.report(node, "URL package must specify .name")
+	}
+
+	label := "URL package"
+	if name != nil && name.Value != "" {
+		label = fmt.Sprintf("URL package %q", name.Value)
+	}
+
+	sources := findMappingValue(node, "sources")
+	if sources == nil {
+		v.report(node, "%s must specify .sources", label)
+		return
+	}
+
+	if sources.Kind != yaml.MappingNode {
+		v.report(sources, "%s .sources must be a mapping of platform to url and sha256", label)
+		return
+	}
+
+	// INFO: a URL package is skipped on platforms left out by its platforms, so it needs no source there
+	forCurrentPlatform := true
+	if platforms := findMappingValue(node, "platforms"); platforms != nil {
+		v.validatePlatformPatterns(platforms, label)
+
+		var patterns []string
+		if err := platforms.Decode(&patterns); err == nil {
+			forCurrentPlatform = matchesPlatform(patterns, getOSArch())
+		}
+	}
+
+	hasCurrentPlatform := false
+	for i := 0; i < len(sources.Content)-1; i += 2 {
+		platform, source := sources.Content[i], sources.Content[i+1]
+
+		url := findMappingValue(source, "url")
+		if url == nil || url.Value == "" {
+			v.report(source, "%s has no url defined for %s", label, platform.Value)
+			continue
+		}
+
+		if platform.Value == getOSArch() {
+			hasCurrentPlatform = true
+		}
+	}
+
+	if forCurrentPlatform && !hasCurrentPlatform {
+		v.report(sources, "%s has no source defined for %s", label, getOSArch())
+	}
+}
+
+func (v *validator) validateLibraries(node *yaml.Node) {
+	if node.Kind != yaml.SequenceNode {
+		v.report(node, "libraries must be a list")
+		return
+	}
+
+	for _, item := range node.Content {
+		if item.Kind == yaml.MappingNode {
+			v.validatePlatformPackage(item, "library")
+			continue
+		}
+		v.validateNixPackageRef(item, "library")
+	}
+}
+
+// validatePlatformPackage validates the `{nix: <package>, platforms: [<os>/<arch>]}` form of packages
+func (v *validator) validatePlatformPackage(node *yaml.Node, kind string) {
+	nix := findMappingValue(node, "nix")
+	if nix == nil {
+		v.report(node, "%s must specify .nix", kind)
+		return
+	}
+	v.validateNixPackageRef(nix, kind)
+
+	if platforms := findMappingValue(node, "platforms"); platforms != nil {
+		v.validatePlatformPatterns(platforms, kind)
+	}
+}
+
+func (v *validator) validatePlatformPatterns(node *yaml.Node, kind string) {
+	if node.Kind != yaml.SequenceNode {
+		v.report(node, "%s platforms must be a list of <os>/<arch> patterns", kind)
+		return
+	}
+
+	for _, item := range node.Content {
+		v.validatePlatformPattern(item)
+	}
+}
+
+func (v *validator) validatePlatformPattern(node *yaml.Node) {
+	if _, err := path.Match(node.Value, ""); err != nil || !strings.Contains(node.Value, "/") {
+		v.report(node, "invalid platform %q, must be an <os>/<arch> pattern (e.g. linux/*, darwin/arm64)", node.Value)
+	}
+}
+
+func (v *validator) validatePlatformEnv(node *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		v.report(node, "platformEnv must be a mapping of <os>/<arch> pattern to env")
+		return
+	}
+
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		pattern, env := node.Content[i], node.Content[i+1]
+		v.validatePlatformPattern(pattern)
+		if env.Kind != yaml.MappingNode {
+			v.report(env, "platformEnv.%s must be a mapping of env var to its value", pattern.Value)
+		}
+	}
+}
+
+func (v *validator) validateBuilds(node *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		v.report(node, "builds must be a mapping of build target to its definition")
+		return
+	}
+
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		target, build := node.Content[i], node.Content[i+1]
+		if build.Kind != yaml.MappingNode {
+			v.report(build, "build target %q must be a mapping", target.Value)
+			continue
+		}
+
+		if pkgs := findMappingValue(build, "packages"); pkgs != nil {
+			if pkgs.Kind != yaml.SequenceNode {
+				v.report(pkgs, "build target %q packages must be a list", target.Value)
+			} else {
+				for _, item := range pkgs.Content {
+					if item.Kind == yaml.MappingNode {
+						v.validatePlatformPackage(item, "package")
+						continue
+					}
+					v.validateNixPackageRef(item, "package")
+				}
+			}
+		}
+
+		paths := findMappingValue(build, "paths")
+		if paths == nil {
+			continue
+		}
+
+		if paths.Kind != yaml.SequenceNode {
+			v.report(paths, "build target %q paths must be a list", target.Value)
+			continue
+		}
+
+		for _, p := range paths.Content {
+			if _, err := os.Stat(filepath.Join(v.baseDir, p.Value)); err != nil {
+				v.report(p, "build target %q references missing path %q", target.Value, p.Value)
+			}
+		}
+	}
+}
+
+func (v *validator) validateMounts(node *yaml.Node) {
+	if node.Kind != yaml.SequenceNode {
+		v.report(node, "mounts must be a list")
+		return
+	}
+
+	for _, mount := range node.Content {
+		if mount.Kind != yaml.MappingNode {
+			v.report(mount, "mount must be a mapping with source and dest")
+			continue
+		}
+
+		for _, key := range []string{"source", "dest"} {
+			value := findMappingValue(mount, key)
+			if value == nil {
+				v.report(mount, "mount has no %s", key)
+				continue
+			}
+
+			if strings.TrimSpace(value.Value) == "" {
+				v.report(value, "mount has empty %s", key)
+			}
+		}
+	}
+}
+
+func (v *validator) validateScripts(node *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		v.report(node, "scripts must be a mapping of script name to its command")
+		return
+	}
+
+	names := make([]string, 0, len(node.Content)/2)
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		names = append(names, node.Content[i].Value)
+	}
+
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		name, script := node.Content[i], node.Content[i+1]
+		switch script.Kind {
+		case yaml.ScalarNode:
+			if strings.TrimSpace(script.Value) == "" {
+				v.report(script, "script %q has an empty command", name.Value)
+			}
+		case yaml.MappingNode:
+			if cmd := findMappingValue(script, "cmd"); cmd == nil || strings.TrimSpace(cmd.Value) == "" {
+				v.report(script, "script %q must specify .cmd", name.Value)
+			}
+
+			depends := findMappingValue(script, "depends")
+			if depends == nil {
+				continue
+			}
+
+			if depends.Kind != yaml.SequenceNode {
+				v.report(depends, "script %q depends must be a list of script names", name.Value)
+				continue
+			}
+
+			for _, dep := range depends.Content {
+				if !slices.Contains(names, dep.Value) {
+					v.report(dep, "script %q depends on %q, which is not defined in scripts", name.Value, dep.Value)
+				}
+			}
+		default:
+			v.report(script, "script %q must either be a command, or a mapping with cmd", name.Value)
+		}
+	}
+}
+
+func (v *validator) validateShells(node *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		v.report(node, "shells must be a mapping of shell variant name to its definition")
+		return
+	}
+
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		name, shell := node.Content[i], node.Content[i+1]
+		if !shellVariantNameRegex.MatchString(name.Value) || name.Value == "default" {
+			v.report(name, "invalid shell variant name %q, must only have letters, digits, _ or -, and must not be default", name.Value)
+		}
+
+		if shell.Kind != yaml.MappingNode {
+			v.report(shell, "shell variant %q must be a mapping", name.Value)
+			continue
+		}
+
+		pkgs := findMappingValue(shell, "packages")
+		if pkgs == nil {
+			continue
+		}
+
+		if pkgs.Kind != yaml.SequenceNode {
+			v.report(pkgs, "shell variant %q packages must be a list", name.Value)
+			continue
+		}
+
+		for _, item := range pkgs.Content {
+			if item.Kind == yaml.MappingNode {
+				v.validatePlatformPackage(item, "package")
+				continue
+			}
+			v.validateNixPackageRef(item, "package")
+		}
+	}
+}
+
+func (v *validator) validateOverlays(node *yaml.Node) {
+	if node.Kind != yaml.SequenceNode {
+		v.report(node, "overlays must be a list of .nix files")
+		return
+	}
+
+	for _, item := range node.Content {
+		p := item.Value
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(v.baseDir, p)
+		}
+
+		if _, err := os.Stat(p); err != nil {
+			v.report(item, "overlay %q does not exist", item.Value)
+		}
+	}
+}
+
+// closestKey returns the known key, that is only a few edits away from the given key
+func closestKey(key string, known []string) string {
+	best, bestDistance := "", -1
+	for _, k := range known {
+		d := editDistance(strings.ToLower(key), strings.ToLower(k))
+		if d > max(1, len(k)/4) {
+			continue
+		}
+
+		if bestDistance == -1 || d < bestDistance {
+			best, bestDistance = k, d
+		}
+	}
+	return best
+}
+
+// editDistance computes levenshtein distance between two strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
@@ -0,0 +1,200 @@
+package nixy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name: "valid nixy file",
+			input: `nixpkgs:
+  default: abc123
+  unstable: def456
+packages:
+  - go
+  - unstable#ripgrep
+libraries:
+  - zlib
+builds:
+  app:
+    packages:
+      - go
+    paths:
+      - nixy.yml
+mounts:
+  - source: /run
+    dest: /run
+`,
+			want: nil,
+		},
+		{
+			name: "unknown top level keys",
+			input: `nixpkgs:
+  default: abc123
+onShellEntry: echo hi
+foo: bar
+`,
+			want: []string{
+				`3:1: unknown key "onShellEntry", did you mean "onShellEnter" ?`,
+				`4:1: unknown key "foo"`,
+			},
+		},
+		{
+			name: "undefined nixpkgs keys",
+			input: `nixpkgs:
+  default: abc123
+packages:
+  - go
+  - stable#nodejs
+libraries:
+  - unstable#openssl
+`,
+			want: []string{
+				`5:5: package "stable#nodejs" refers to nixpkgs key "stable", which is not defined in nixpkgs`,
+				`7:5: library "unstable#openssl" refers to nixpkgs key "unstable", which is not defined in nixpkgs`,
+			},
+		},
+		{
+			name: "missing default nixpkgs",
+			input: `nixpkgs:
+  stable: abc123
+`,
+			want: []string{
+				`2:3: nixpkgs must have a default key, containing a nixpkgs hash`,
+			},
+		},
+		{
+			name: "url package without a source for current platform",
+			input: `nixpkgs:
+  default: abc123
+packages:
+  - name: run
+    sources:
+      plan9/mips:
+        url: ""
+`,
+			want: []string{
+				`6:7: URL package "run" has no source defined for ` + getOSArch(),
+				`7:9: URL package "run" has no url defined for plan9/mips`,
+			},
+		},
+		{
+			name: "url package for other platforms only",
+			input: `nixpkgs:
+  default: abc123
+packages:
+  - name: run
+    platforms: [plan9/*]
+    sources:
+      plan9/mips:
+        url: https://example.com/run-plan9-mips
+`,
+			want: nil,
+		},
+		{
+			name: "mounts with empty source or dest",
+			input: `nixpkgs:
+  default: abc123
+mounts:
+  - source: ""
+    dest: /run
+  - source: /run
+`,
+			want: []string{
+				`4:13: mount has empty source`,
+				`6:5: mount has no dest`,
+			},
+		},
+		{
+			name: "platform specific packages and env",
+			input: `nixpkgs:
+  default: abc123
+packages:
+  - nix: glibcLocales
+    platforms: [linux/*]
+  - nix: stable#coreutils
+    platforms: [darwin]
+libraries:
+  - nix: zlib
+    platforms: linux/amd64
+platformEnv:
+  darwin/*:
+    CC: clang
+  "linux/[":
+    CC: gcc
+`,
+			want: []string{
+				`6:10: package "stable#coreutils" refers to nixpkgs key "stable", which is not defined in nixpkgs`,
+				`7:17: invalid platform "darwin", must be an <os>/<arch> pattern (e.g. linux/*, darwin/arm64)`,
+				`10:16: library platforms must be a list of <os>/<arch> patterns`,
+				`14:3: invalid platform "linux/[", must be an <os>/<arch> pattern (e.g. linux/*, darwin/arm64)`,
+			},
+		},
+		{
+			name: "build with missing paths",
+			input: `nixpkgs:
+  default: abc123
+builds:
+  app:
+    paths:
+      - nixy.yml
+      - does-not-exist
+`,
+			want: []string{
+				`7:9: build target "app" references missing path "does-not-exist"`,
+			},
+		},
+		{
+			name: "build with platform specific packages",
+			input: `nixpkgs:
+  default: abc123
+builds:
+  app:
+    packages:
+      - go
+      - nix: glibcLocales
+        platforms: [linux/*]
+      - nix: undefined#jq
+`,
+			want: []string{
+				`9:14: package "undefined#jq" refers to nixpkgs key "undefined", which is not defined in nixpkgs`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "nixy.yml")
+			if err := os.WriteFile(file, []byte(tt.input), 0o644); err != nil {
+				t.Fatalf("failed to write nixy file: %v", err)
+			}
+
+			diags, err := Validate(file)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := make([]string, 0, len(diags))
+			for _, d := range diags {
+				got = append(got, d.String()[len(file)+1:])
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("mismatch:\ngot:\n%q\nwant:\n%q", got, tt.want)
+			}
+
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("mismatch:\ngot:\n%s\nwant:\n%s", got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
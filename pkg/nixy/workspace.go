@@ -0,0 +1,142 @@
+package nixy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// workspaceMetadataFileName is kept in every workspace flake dir, to know which project it belongs to
+const workspaceMetadataFileName = "workspace.json"
+
+// WorkspaceMetadata records the project, a workspace flake dir belongs to
+type WorkspaceMetadata struct {
+	ProjectDir  string    `json:"projectDir"`
+	LastUsedAt  time.Time `json:"lastUsedAt"`
+	NixyVersion string    `json:"nixyVersion"`
+	Executor    Mode      `json:"executor"`
+}
+
+// Workspace is a workspace flake dir, found under a profile's workspaces dir
+type Workspace struct {
+	Dir     string `json:"dir"`
+	Profile string `json:"profile"`
+
+	// HasMetadata is false for workspaces created by older nixy versions. LastUsedAt is then the dir's modification time
+	HasMetadata bool `json:"hasMetadata"`
+
+	WorkspaceMetadata
+}
+
+// ProjectExists tells whether the project directory of the workspace still exists
+func (w *Workspace) ProjectExists() bool {
+	return w.ProjectDir != "" && exists(w.ProjectDir)
+}
+
+// saveWorkspaceMetadata records (or refreshes) the metadata of the workspace flake dir, for project at projectDir
+func saveWorkspaceMetadata(flakeDir string, projectDir string, mode Mode) error {
+	b, err := json.MarshalIndent(WorkspaceMetadata{
+		ProjectDir:  projectDir,
+		LastUsedAt:  time.Now(),
+		NixyVersion: os.Getenv("NIXY_VERSION"),
+		Executor:    mode,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(flakeDir, 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(flakeDir, workspaceMetadataFileName), b, 0o644)
+}
+
+// ListWorkspaces returns workspaces of every profile, most recently used first
+func ListWorkspaces() ([]Workspace, error) {
+	dirs, err := filepath.Glob(filepath.Join(profileBasePath, "*", "workspaces", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	workspaces := make([]Workspace, 0, len(dirs))
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+
+		ws := Workspace{
+			Dir:     dir,
+			Profile: filepath.Base(filepath.Dir(filepath.Dir(dir))),
+		}
+
+		b, err := os.ReadFile(filepath.Join(dir, workspaceMetadataFileName))
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(b, &ws.WorkspaceMetadata); err != nil {
+				return nil, fmt.Errorf("failed to parse workspace metadata (%s): %w", filepath.Join(dir, workspaceMetadataFileName), err)
+			}
+			ws.HasMetadata = true
+		case errors.Is(err, os.ErrNotExist):
+			ws.LastUsedAt = info.ModTime()
+		default:
+			return nil, err
+		}
+
+		workspaces = append(workspaces, ws)
+	}
+
+	slices.SortFunc(workspaces, func(a, b Workspace) int {
+		return b.LastUsedAt.Compare(a.LastUsedAt)
+	})
+
+	return workspaces, nil
+}
+
+// GCCandidate is a workspace to be garbage collected, with the reason for it
+type GCCandidate struct {
+	Workspace
+	Reason string `json:"reason"`
+}
+
+// gcCandidates returns workspaces, whose project directory no longer exists,
+// or which have not been used since olderThan (when non zero)
+func gcCandidates(workspaces []Workspace, olderThan time.Duration, now time.Time) []GCCandidate {
+	candidates := make([]GCCandidate, 0, len(workspaces))
+	for _, ws := range workspaces {
+		switch {
+		case ws.HasMetadata && !ws.ProjectExists():
+			candidates = append(candidates, GCCandidate{Workspace: ws, Reason: fmt.Sprintf("project dir %s no longer exists", ws.ProjectDir)})
+		case olderThan > 0 && now.Sub(ws.LastUsedAt) > olderThan:
+			candidates = append(candidates, GCCandidate{Workspace: ws, Reason: fmt.Sprintf("not used for %d days", int(now.Sub(ws.LastUsedAt).Hours()/24))})
+		}
+	}
+	return candidates
+}
+
+// GCWorkspaces removes workspaces, whose project directory no longer exists,
+// or which have not been used since olderThan (when non zero). With dryRun, it only returns them
+func GCWorkspaces(olderThan time.Duration, dryRun bool) ([]GCCandidate, error) {
+	workspaces, err := ListWorkspaces()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := gcCandidates(workspaces, olderThan, time.Now())
+	if dryRun {
+		return candidates, nil
+	}
+
+	for _, c := range candidates {
+		if err := os.RemoveAll(c.Dir); err != nil {
+			return nil, fmt.Errorf("failed to remove workspace %s: %w", c.Dir, err)
+		}
+	}
+
+	return candidates, nil
+}
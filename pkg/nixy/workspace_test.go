@@ -0,0 +1,85 @@
+package nixy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListWorkspacesAndGC(t *testing.T) {
+	base := t.TempDir()
+	oldBase := profileBasePath
+	profileBasePath = filepath.Join(base, "profiles")
+	t.Cleanup(func() { profileBasePath = oldBase })
+
+	project := filepath.Join(base, "project")
+	if err := os.MkdirAll(project, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	workspacesDir := filepath.Join(profileBasePath, "default", "workspaces")
+	active := deriveWorkspacePath(workspacesDir, project)
+	if err := saveWorkspaceMetadata(active, project, LocalMode); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted := deriveWorkspacePath(workspacesDir, filepath.Join(base, "deleted-project"))
+	if err := saveWorkspaceMetadata(deleted, filepath.Join(base, "deleted-project"), DockerMode); err != nil {
+		t.Fatal(err)
+	}
+
+	// INFO: workspaces created by older nixy versions, have no metadata
+	legacy := filepath.Join(workspacesDir, "legacy")
+	if err := os.MkdirAll(legacy, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-60 * 24 * time.Hour)
+	if err := os.Chtimes(legacy, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	workspaces, err := ListWorkspaces()
+	if err != nil {
+		t.Fatalf("ListWorkspaces() error = %v", err)
+	}
+
+	if len(workspaces) != 3 {
+		t.Fatalf("ListWorkspaces() returned %d workspaces, want 3", len(workspaces))
+	}
+
+	if last := workspaces[2]; last.Dir != legacy || last.HasMetadata {
+		t.Errorf("least recently used workspace = %+v, want legacy one without metadata", last)
+	}
+
+	tests := []struct {
+		name      string
+		olderThan time.Duration
+		want      []string
+	}{
+		{name: "only missing projects", want: []string{deleted}},
+		{name: "older than 30 days too", olderThan: 30 * 24 * time.Hour, want: []string{deleted, legacy}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := gcCandidates(workspaces, tt.olderThan, time.Now())
+			if len(got) != len(tt.want) {
+				t.Fatalf("gcCandidates() = %+v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].Dir != tt.want[i] {
+					t.Errorf("gcCandidates()[%d] = %s, want %s", i, got[i].Dir, tt.want[i])
+				}
+			}
+		})
+	}
+
+	removed, err := GCWorkspaces(0, false)
+	if err != nil {
+		t.Fatalf("GCWorkspaces() error = %v", err)
+	}
+	if len(removed) != 1 || exists(deleted) || !exists(active) {
+		t.Errorf("GCWorkspaces() must remove only the workspace of deleted project, removed: %+v", removed)
+	}
+}
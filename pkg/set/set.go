@@ -19,6 +19,11 @@ func (s *Set[T]) Add(item T) {
 	}
 }
 
+func (s *Set[T]) Has(item T) bool {
+	_, ok := s.items[item]
+	return ok
+}
+
 func (s *Set[T]) ToSortedList() []T {
 	result := make([]T, 0, len(s.items))
 	for item := range s.items {